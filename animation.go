@@ -0,0 +1,408 @@
+package svg
+
+// This file implements the parsing of the SMIL animation elements:
+// animate, set, animateTransform and animateMotion. They are gathered
+// into a timeline, evaluated by Svg.At.
+
+import (
+	"encoding/xml"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Indefinite is the duration of the animations which do not end.
+const Indefinite time.Duration = math.MaxInt64
+
+// CalcMode is the interpolation mode of an animation.
+type CalcMode uint8
+
+const (
+	CalcLinear   CalcMode = iota // values are interpolated linearly
+	CalcDiscrete                 // values jump from one to the next
+	CalcPaced                    // values change at an even pace
+	CalcSpline                   // values are interpolated along keySplines
+)
+
+// TimingValue is an item of the begin or end attribute of an animation.
+type TimingValue struct {
+	Offset     time.Duration
+	Syncbase   string // id of the animation whose begin or end the offset is relative to, if any
+	SyncEnd    bool   // the offset is relative to the end of Syncbase
+	Unresolved bool   // indefinite, or an event, which never occurs in a snapshot
+}
+
+// Animation is an animation element, changing an attribute
+// of its target element over time.
+type Animation struct {
+	ID        string
+	Element   string // animate, set, animateTransform or animateMotion; animate for CSS animations
+	Keyframes string // name of the @keyframes rule of a CSS animation
+	Attribute string // attributeName, or transform for animateMotion
+	Type      string // type of animateTransform, such as rotate
+
+	// Values are the values of the values attribute, or the ones given by
+	// the from, to and by attributes. An empty value stands for the value
+	// of the attribute without the animation.
+	Values     []string
+	KeyTimes   []float64
+	KeySplines [][4]float64
+	CalcMode   CalcMode
+	Additive   bool // additive="sum"
+	Accumulate bool // accumulate="sum"
+	Freeze     bool // fill="freeze"
+
+	Begin, End  []TimingValue
+	Dur         time.Duration // simple duration, Indefinite if not specified
+	RepeatCount float64       // 0 if not specified, +Inf if indefinite
+	RepeatDur   time.Duration // 0 if not specified
+
+	// Path is the path of an animateMotion element, from its path attribute
+	// or its mpath child. Values are then ignored.
+	Path      Path
+	KeyPoints []float64
+	Rotate    string // auto, auto-reverse or an angle, in degrees
+
+	target    int                     // index of the start token of the animated element
+	easings   []func(float64) float64 // timing functions of the intervals of values of CSS animations
+	direction string                  // animation-direction of a CSS animation
+	backwards bool                    // the first value applies before a CSS animation begins
+}
+
+// animationElements are the elements read by readAnimations, which are
+// not drawn. The deprecated animateColor element is handled as animate.
+var animationElements = map[string]bool{
+	"animate": true, "set": true, "animateTransform": true, "animateMotion": true, "animateColor": true,
+}
+
+// readAnimations gathers the animation elements of the document into the
+// timeline of the image. The target of an animation is its parent, or
+// the element referenced by its href attribute.
+func (c *svgCursor) readAnimations() error {
+	var (
+		open    []int // start tokens of the open elements
+		current *Animation
+	)
+	for i, t := range c.svg.doc.tokens {
+		switch t := t.(type) {
+		case xml.StartElement:
+			if t.Name.Space != "" && t.Name.Space != SvgNamespace {
+				open = append(open, i)
+				continue
+			}
+			switch {
+			case animationElements[t.Name.Local] && len(open) > 0:
+				a, err := c.readAnimation(t, open[len(open)-1])
+				if err != nil {
+					return err
+				}
+				if a != nil {
+					c.svg.Animations = append(c.svg.Animations, a)
+				}
+				current = a
+			case t.Name.Local == "mpath" && current != nil && current.Element == "animateMotion":
+				if err := c.readMotionPath(current, t.Attr); err != nil {
+					return err
+				}
+			}
+			open = append(open, i)
+		case xml.EndElement:
+			if animationElements[t.Name.Local] {
+				current = nil
+			}
+			if n := len(open); n > 0 {
+				open = open[:n-1]
+			}
+		}
+	}
+	return nil
+}
+
+// readAnimation returns the animation described by se, whose parent
+// starts at the given token. It returns nil if it has no target.
+func (c *svgCursor) readAnimation(se xml.StartElement, parent int) (*Animation, error) {
+	a := &Animation{
+		Element: se.Name.Local,
+		Dur:     Indefinite,
+		Begin:   []TimingValue{{}},
+		target:  parent,
+	}
+	if a.Element == "animateColor" {
+		a.Element = "animate"
+	}
+	var (
+		from, to, by string
+		hasValues    bool
+		err          error
+	)
+	attrs := make(map[string]string, len(se.Attr))
+	for _, attr := range se.Attr {
+		attrs[attr.Name.Local] = attr.Value
+	}
+	for _, attr := range se.Attr {
+		v := strings.TrimSpace(attr.Value)
+		switch attr.Name.Local {
+		case "id":
+			a.ID = v
+		case "href":
+			id := strings.TrimPrefix(v, "#")
+			s, ok := c.svg.doc.ids[id]
+			if !ok || !strings.HasPrefix(v, "#") {
+				return nil, c.handleError("target %s of <%s> was not found", v, se.Name.Local)
+			}
+			a.target = s.start
+		case "attributeName":
+			_, a.Attribute, _ = strings.Cut(v, ":") // xlink:href
+			if a.Attribute == "" {
+				a.Attribute = v
+			}
+		case "type":
+			a.Type = v
+		case "values":
+			hasValues = true
+			for _, value := range strings.Split(v, ";") {
+				a.Values = append(a.Values, strings.TrimSpace(value))
+			}
+			if n := len(a.Values); n > 1 && a.Values[n-1] == "" { // trailing semicolon
+				a.Values = a.Values[:n-1]
+			}
+		case "from":
+			from = v
+		case "to":
+			to = v
+		case "by":
+			by = v
+		case "keyTimes":
+			a.KeyTimes, err = parseFloatList(v)
+		case "keyPoints":
+			a.KeyPoints, err = parseFloatList(v)
+		case "keySplines":
+			a.KeySplines, err = parseKeySplines(v)
+		case "calcMode":
+			switch v {
+			case "discrete":
+				a.CalcMode = CalcDiscrete
+			case "paced":
+				a.CalcMode = CalcPaced
+			case "spline":
+				a.CalcMode = CalcSpline
+			}
+		case "additive":
+			a.Additive = v == "sum"
+		case "accumulate":
+			a.Accumulate = v == "sum"
+		case "fill":
+			a.Freeze = v == "freeze"
+		case "begin":
+			a.Begin, err = parseTimingValues(v)
+		case "end":
+			a.End, err = parseTimingValues(v)
+		case "dur":
+			if v != "indefinite" && v != "media" {
+				a.Dur, err = parseClockValue(v)
+				if err == nil && a.Dur <= 0 {
+					a.Dur = Indefinite
+				}
+			}
+		case "repeatCount":
+			if v == "indefinite" {
+				a.RepeatCount = math.Inf(1)
+			} else {
+				a.RepeatCount, err = parseBasicFloat(v)
+			}
+		case "repeatDur":
+			if v == "indefinite" {
+				a.RepeatDur = Indefinite
+			} else {
+				a.RepeatDur, err = parseClockValue(v)
+			}
+		case "path":
+			var pc pathCursor
+			err = pc.compilePath(v)
+			a.Path = pc.path
+		case "rotate":
+			a.Rotate = v
+		}
+		if err != nil {
+			return nil, c.handleError("invalid attribute %s of <%s>: %s", attr.Name.Local, se.Name.Local, err)
+		}
+	}
+	switch a.Element {
+	case "set":
+		a.Values, a.CalcMode, a.Additive, a.Accumulate = []string{to}, CalcDiscrete, false, false
+	case "animateMotion":
+		a.Attribute = "transform"
+		if _, ok := attrs["calcMode"]; !ok {
+			a.CalcMode = CalcPaced
+		}
+	}
+	if !hasValues && a.Element != "set" {
+		// a to animation is not additive, and a by animation always is
+		switch {
+		case from != "" && to != "":
+			a.Values = []string{from, to}
+		case from != "" && by != "":
+			a.Values = []string{from, addValues(from, by, 1)}
+		case to != "":
+			a.Values, a.Additive, a.Accumulate = []string{"", to}, false, false
+		case by != "":
+			a.Values, a.Additive = []string{zeroValue(by), by}, true
+		}
+	}
+	if a.Attribute == "" {
+		return nil, c.handleError("missing attributeName in <%s>", se.Name.Local)
+	}
+	return a, nil
+}
+
+// readMotionPath sets the path of the animateMotion
+// element a to the path referenced by the mpath element.
+func (c *svgCursor) readMotionPath(a *Animation, attrs []xml.Attr) error {
+	for _, attr := range attrs {
+		if attr.Name.Local != "href" {
+			continue
+		}
+		name, pathAttrs, ok := c.lookupShape(strings.TrimPrefix(attr.Value, "#"))
+		if !ok || name != "path" {
+			return c.handleError("path %s of <mpath> was not found", attr.Value)
+		}
+		for _, pa := range pathAttrs {
+			if pa.Name.Local == "d" {
+				var pc pathCursor
+				if err := pc.compilePath(pa.Value); err != nil {
+					return c.handleError("invalid path of <mpath>: %s", err)
+				}
+				a.Path = pc.path
+			}
+		}
+	}
+	return nil
+}
+
+// parseClockValue parses a clock value, such as "2s",
+// "500ms", "1.5" (seconds), "0:30" or "1:02:30.5".
+func parseClockValue(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return 0, errParamMismatch
+		}
+		var seconds float64
+		for _, part := range parts {
+			f, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return 0, err
+			}
+			seconds = seconds*60 + f
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	unit := time.Second
+	for _, u := range []struct {
+		suffix string
+		unit   time.Duration
+	}{{"ms", time.Millisecond}, {"min", time.Minute}, {"h", time.Hour}, {"s", time.Second}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.unit
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(f * float64(unit)), nil
+}
+
+// parseTimingValues parses a begin or end attribute. Syncbase values
+// such as "other.end+1s" are supported, while events never occur.
+func parseTimingValues(s string) ([]TimingValue, error) {
+	var out []TimingValue
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var tv TimingValue
+		if c := item[0]; c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9') {
+			offset, err := parseClockValue(strings.TrimPrefix(item, "+"))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, TimingValue{Offset: offset})
+			continue
+		}
+		// the offset of a syncbase value follows its begin or end keyword
+		offset := ""
+		for _, keyword := range []string{".begin", ".end"} {
+			if i := strings.Index(item, keyword); i > 0 {
+				tv.Syncbase, tv.SyncEnd = item[:i], keyword == ".end"
+				offset = strings.TrimSpace(item[i+len(keyword):])
+				break
+			}
+		}
+		if tv.Syncbase == "" || (offset != "" && offset[0] != '+' && offset[0] != '-') {
+			// events, and other values which are not supported
+			out = append(out, TimingValue{Unresolved: true})
+			continue
+		}
+		if offset != "" {
+			sign := time.Duration(1)
+			if offset[0] == '-' {
+				sign = -1
+			}
+			d, err := parseClockValue(offset[1:])
+			if err != nil {
+				return nil, err
+			}
+			tv.Offset = sign * d
+		}
+		out = append(out, tv)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("empty timing value list")
+	}
+	return out, nil
+}
+
+// parseFloatList parses a semicolon separated list of numbers
+func parseFloatList(s string) ([]float64, error) {
+	var out []float64
+	for _, item := range strings.Split(s, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		f, err := parseBasicFloat(item)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// parseKeySplines parses the control points of the keySplines attribute
+func parseKeySplines(s string) ([][4]float64, error) {
+	var out [][4]float64
+	for _, item := range strings.Split(s, ";") {
+		fields := splitOnCommaOrSpace(strings.TrimSpace(item))
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, errParamMismatch
+		}
+		var spline [4]float64
+		for i, f := range fields {
+			var err error
+			if spline[i], err = parseBasicFloat(f); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, spline)
+	}
+	return out, nil
+}
@@ -0,0 +1,103 @@
+package svg
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Align is the alignment of a box along one axis of a viewport.
+type Align uint8
+
+const (
+	AlignMid Align = iota // default value
+	AlignMin
+	AlignMax
+)
+
+// AspectRatio is the value of a preserveAspectRatio attribute.
+// The zero value is "xMidYMid meet".
+type AspectRatio struct {
+	X, Y  Align
+	None  bool // scale non-uniformly to fill the viewport
+	Slice bool // cover the viewport, instead of fitting in it
+}
+
+// offset returns the offset of a box, smaller than its viewport by extra
+func (a Align) offset(extra float64) float64 {
+	switch a {
+	case AlignMin:
+		return 0
+	case AlignMax:
+		return extra
+	default:
+		return extra / 2
+	}
+}
+
+// Transform returns the transform fitting box into the viewport.
+func (a AspectRatio) Transform(box, viewport Bounds) Matrix2D {
+	if box.W <= 0 || box.H <= 0 {
+		return Identity
+	}
+	sx, sy := viewport.W/box.W, viewport.H/box.H
+	if !a.None {
+		s := math.Min(sx, sy)
+		if a.Slice {
+			s = math.Max(sx, sy)
+		}
+		sx, sy = s, s
+	}
+	return Matrix2D{
+		A: sx, D: sy,
+		E: viewport.X - box.X*sx + a.X.offset(viewport.W-box.W*sx),
+		F: viewport.Y - box.Y*sy + a.Y.offset(viewport.H-box.H*sy),
+	}
+}
+
+func parseAlign(s string) (Align, bool) {
+	switch s {
+	case "Min":
+		return AlignMin, true
+	case "Mid":
+		return AlignMid, true
+	case "Max":
+		return AlignMax, true
+	}
+	return 0, false
+}
+
+// parseAspectRatio parses a preserveAspectRatio attribute
+func parseAspectRatio(v string) (AspectRatio, error) {
+	var a AspectRatio
+	fields := strings.Fields(v)
+	if len(fields) > 0 && fields[0] == "defer" {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return a, fmt.Errorf("invalid preserveAspectRatio %q", v)
+	}
+	if fields[0] == "none" {
+		a.None = true
+	} else {
+		align := fields[0]
+		var okX, okY bool
+		if len(align) == 8 && align[0] == 'x' && align[4] == 'Y' {
+			a.X, okX = parseAlign(align[1:4])
+			a.Y, okY = parseAlign(align[5:8])
+		}
+		if !okX || !okY {
+			return a, fmt.Errorf("invalid preserveAspectRatio %q", v)
+		}
+	}
+	if len(fields) == 2 {
+		switch fields[1] {
+		case "meet":
+		case "slice":
+			a.Slice = true
+		default:
+			return a, fmt.Errorf("invalid preserveAspectRatio %q", v)
+		}
+	}
+	return a, nil
+}
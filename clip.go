@@ -0,0 +1,114 @@
+package svg
+
+import (
+	"encoding/xml"
+)
+
+// SvgClipPath is an SVG element that defines a clipping region for the referenced elements.
+// The region is the union of its paths, each one filled according to its clip-rule,
+// and clipped by its own clip paths if any.
+type SvgClipPath struct {
+	ID    string
+	Units GradientUnits // clipPathUnits
+
+	// SvgPaths are expressed in the user space of the referencing element,
+	// that is their Transform does not include the one of that element.
+	SvgPaths []SvgPath
+}
+
+// ClipRef is a clip path applied to an element and its descendants.
+type ClipRef struct {
+	ID string
+	// Transform is the transform of the user space of the referencing element
+	Transform Matrix2D
+	// Bounds is the bounding box of the referencing element, in its user space.
+	// It is used by clip paths in objectBoundingBox units.
+	Bounds Bounds
+
+	hasBounds bool
+}
+
+// Matrix returns the transform of the content of the clip path, when applied
+// by ref. The transform of the paths of the clip path must be applied first.
+func (cp *SvgClipPath) Matrix(ref *ClipRef) Matrix2D {
+	m := ref.Transform
+	if cp.Units == ObjectBoundingBox {
+		m = m.Mult(Matrix2D{A: ref.Bounds.W, D: ref.Bounds.H, E: ref.Bounds.X, F: ref.Bounds.Y})
+	}
+	return m
+}
+
+// extend grows the bounding box of the referencing element to hold
+// the path, whose transform is m.
+func (r *ClipRef) extend(p Path, m Matrix2D) {
+	pl := flattenPath(p, r.Transform.Invert().Mult(m))
+	for _, pt := range pl {
+		if !r.hasBounds {
+			r.Bounds = Bounds{X: pt.x, Y: pt.y}
+			r.hasBounds = true
+			continue
+		}
+		if pt.x < r.Bounds.X {
+			r.Bounds.W += r.Bounds.X - pt.x
+			r.Bounds.X = pt.x
+		} else if pt.x > r.Bounds.X+r.Bounds.W {
+			r.Bounds.W = pt.x - r.Bounds.X
+		}
+		if pt.y < r.Bounds.Y {
+			r.Bounds.H += r.Bounds.Y - pt.y
+			r.Bounds.Y = pt.y
+		} else if pt.y > r.Bounds.Y+r.Bounds.H {
+			r.Bounds.H = pt.y - r.Bounds.Y
+		}
+	}
+}
+
+func containsClipRef(refs []*ClipRef, r *ClipRef) bool {
+	for _, ref := range refs {
+		if ref == r {
+			return true
+		}
+	}
+	return false
+}
+
+func clipPathF(c *svgCursor, attrs []xml.Attr) error {
+	clip := &SvgClipPath{Units: UserSpaceOnUse}
+	m := Identity
+	var err error
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "id":
+			clip.ID = attr.Value
+		case "clipPathUnits":
+			if attr.Value == "objectBoundingBox" {
+				clip.Units = ObjectBoundingBox
+			}
+		case "transform":
+			m, err = c.parseTransformFrom(Identity, attr.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// the content of the clip path is in the user space of the
+	// referencing element, whatever the ancestors of the clipPath element
+	style := &c.styleStack[len(c.styleStack)-1]
+	inherited := len(c.styleStack[len(c.styleStack)-2].ClipPaths)
+	style.Transform = m
+	style.ClipPaths = style.ClipPaths[inherited:]
+	for _, ref := range style.ClipPaths {
+		ref.Transform = Identity
+	}
+	style.Masks = nil
+	c.clip = clip
+	return nil
+}
+
+// endClipPath stores the clip path which just ended
+func (c *svgCursor) endClipPath() {
+	if c.clip != nil && c.clip.ID != "" {
+		c.svg.ClipPaths[c.clip.ID] = c.clip
+	}
+	c.clip = nil
+}
@@ -0,0 +1,70 @@
+package svg
+
+// This file implements conditional processing, with the switch element
+// and the systemLanguage, requiredFeatures and requiredExtensions attributes.
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// switchF starts a switch element, whose first
+// child with true conditions is the only one drawn
+func switchF(c *svgCursor, attrs []xml.Attr) error {
+	c.switches = append(c.switches, switchFrame{depth: len(c.styleStack)})
+	return nil
+}
+
+// switchFrame is the state of an open switch element
+type switchFrame struct {
+	depth   int  // length of the style stack when reading the children
+	matched bool // a child was drawn
+}
+
+// isSwitchedOff returns true if the element starting is a child of
+// a switch element, preceded by a child which is drawn
+func (c *svgCursor) isSwitchedOff() bool {
+	if n := len(c.switches); n > 0 && c.switches[n-1].depth == len(c.styleStack) {
+		if c.switches[n-1].matched {
+			return true
+		}
+		c.switches[n-1].matched = true
+	}
+	return false
+}
+
+// evaluateConditions returns false if one of the
+// conditional processing attributes is not satisfied
+func (c *svgCursor) evaluateConditions(attrs []xml.Attr) bool {
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "systemLanguage":
+			if !c.matchLanguage(attr.Value) {
+				return false
+			}
+		case "requiredExtensions":
+			// no extension is supported
+			return false
+		case "requiredFeatures":
+			// as in SVG 2, features are not tested
+		}
+	}
+	return true
+}
+
+// matchLanguage returns true if one of the preferred languages is one of the
+// comma separated languages, or one of their prefixes followed by '-'
+func (c *svgCursor) matchLanguage(languages string) bool {
+	for _, lang := range strings.Split(languages, ",") {
+		lang = strings.TrimSpace(lang)
+		for _, pref := range c.options.languages {
+			if len(lang) < len(pref) || !strings.EqualFold(lang[:len(pref)], pref) {
+				continue
+			}
+			if len(lang) == len(pref) || lang[len(pref)] == '-' {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package svg
+
+// This file implements a minimal parser for the stylesheets
+// embedded in style elements.
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+type (
+	// cssRule is a rule of a stylesheet, holding either
+	// declarations or nested rules, such as keyframes
+	cssRule struct {
+		prelude string // selector or at-rule, such as "@font-face"
+		decls   []cssDecl
+		rules   []cssRule
+	}
+
+	cssDecl struct {
+		property, value string
+	}
+)
+
+// stripCSSComments removes the /* */ comments of the stylesheet
+func stripCSSComments(s string) string {
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, "/*")
+		if i < 0 {
+			break
+		}
+		sb.WriteString(s[:i])
+		j := strings.Index(s[i+2:], "*/")
+		if j < 0 {
+			return sb.String()
+		}
+		s = s[i+2+j+2:]
+	}
+	sb.WriteString(s)
+	return sb.String()
+}
+
+// cssScanner tracks quotes and parentheses, so that delimiters
+// inside strings and url() values are ignored
+type cssScanner struct {
+	quote  byte
+	parens int
+}
+
+// plain reports whether the byte b, at the current position, is outside
+// of any string or parenthesis, after updating the state of the scanner.
+func (sc *cssScanner) plain(b byte) bool {
+	switch {
+	case sc.quote != 0:
+		if b == sc.quote {
+			sc.quote = 0
+		}
+		return false
+	case b == '"' || b == '\'':
+		sc.quote = b
+		return false
+	case b == '(':
+		sc.parens++
+		return false
+	case b == ')':
+		if sc.parens > 0 {
+			sc.parens--
+		}
+		return false
+	}
+	return sc.parens == 0
+}
+
+// parseCSS parses the rules of a stylesheet
+func parseCSS(s string) []cssRule {
+	s = stripCSSComments(s)
+	var (
+		rules []cssRule
+		sc    cssScanner
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		if !sc.plain(s[i]) {
+			continue
+		}
+		switch s[i] {
+		case ';':
+			// at-rule without block, such as @import
+			start = i + 1
+		case '{':
+			prelude := strings.TrimSpace(s[start:i])
+			end, nested := matchingBrace(s, i)
+			block := s[i+1 : end]
+			rule := cssRule{prelude: prelude}
+			if nested {
+				rule.rules = parseCSS(block)
+			} else {
+				rule.decls = parseDeclarations(block)
+			}
+			rules = append(rules, rule)
+			i = end
+			start = end + 1
+		}
+	}
+	return rules
+}
+
+// matchingBrace returns the index of the brace closing the one at open,
+// and whether the block holds nested blocks
+func matchingBrace(s string, open int) (end int, nested bool) {
+	var sc cssScanner
+	depth := 0
+	for i := open; i < len(s); i++ {
+		if !sc.plain(s[i]) {
+			continue
+		}
+		switch s[i] {
+		case '{':
+			depth++
+			if depth > 1 {
+				nested = true
+			}
+		case '}':
+			depth--
+			if depth == 0 {
+				return i, nested
+			}
+		}
+	}
+	return len(s), nested
+}
+
+// parseDeclarations parses the declarations of a block, or of a style attribute
+func parseDeclarations(block string) []cssDecl {
+	var (
+		decls []cssDecl
+		sc    cssScanner
+		start int
+	)
+	add := func(d string) {
+		property, value, ok := strings.Cut(d, ":")
+		if !ok {
+			return
+		}
+		value = strings.TrimSpace(value)
+		value = strings.TrimSpace(strings.TrimSuffix(value, "!important"))
+		decls = append(decls, cssDecl{
+			property: strings.ToLower(strings.TrimSpace(property)),
+			value:    value,
+		})
+	}
+	for i := 0; i < len(block); i++ {
+		if sc.plain(block[i]) && block[i] == ';' {
+			add(block[start:i])
+			start = i + 1
+		}
+	}
+	add(block[start:])
+	return decls
+}
+
+// cssURLs returns the targets of the url() functions found in v
+func cssURLs(v string) []string {
+	var urls []string
+	for {
+		i := strings.Index(v, "url(")
+		if i < 0 {
+			return urls
+		}
+		v = v[i+4:]
+		j := strings.Index(v, ")")
+		if j < 0 {
+			return urls
+		}
+		urls = append(urls, strings.Trim(strings.TrimSpace(v[:j]), `"'`))
+		v = v[j+1:]
+	}
+}
+
+func styleF(c *svgCursor, attrs []xml.Attr) error {
+	c.inStyle = true
+	c.styleText.Reset()
+	return nil
+}
+
+// readStylesheet handles the content of the style element which just ended
+func (c *svgCursor) readStylesheet() error {
+	c.inStyle = false
+	for _, rule := range parseCSS(c.styleText.String()) {
+		if strings.ToLower(rule.prelude) == "@font-face" {
+			if err := c.readFontFace(rule.decls); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchSelector returns whether the element, whose ancestors are given from
+// the root, matches the selector list, and the specificity of the matching
+// selector. Simple selectors on the type, id, classes and attributes are
+// supported, combined by descendant and child combinators.
+func matchSelector(selectors string, ancestors []xml.StartElement, se xml.StartElement) (specificity int, ok bool) {
+	for _, selector := range strings.Split(selectors, ",") {
+		compounds, combinators := splitSelector(selector)
+		n := len(compounds)
+		if n == 0 || !matchCompound(compounds[n-1], se) || !matchAncestors(compounds[:n-1], combinators, ancestors) {
+			continue
+		}
+		spec := 0
+		for _, compound := range compounds {
+			for _, simple := range splitCompound(compound) {
+				switch simple[0] {
+				case '#':
+					spec += 10000
+				case '.', '[':
+					spec += 100
+				case '*':
+				default:
+					spec++
+				}
+			}
+		}
+		if !ok || spec > specificity {
+			specificity, ok = spec, true
+		}
+	}
+	return specificity, ok
+}
+
+// splitSelector splits a complex selector into its compound selectors,
+// and the combinators preceding each of them but the first
+func splitSelector(selector string) (compounds []string, combinators []byte) {
+	selector = strings.ReplaceAll(selector, ">", " > ")
+	combinator := byte(' ')
+	for _, field := range strings.Fields(selector) {
+		if field == ">" {
+			combinator = '>'
+			continue
+		}
+		if len(compounds) > 0 {
+			combinators = append(combinators, combinator)
+		}
+		compounds = append(compounds, field)
+		combinator = ' '
+	}
+	return compounds, combinators
+}
+
+// matchAncestors matches the compound selectors, last first, against
+// the ancestors of an element, backtracking on descendant combinators
+func matchAncestors(compounds []string, combinators []byte, ancestors []xml.StartElement) bool {
+	if len(compounds) == 0 {
+		return true
+	}
+	last, combinator := compounds[len(compounds)-1], combinators[len(combinators)-1]
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		if matchCompound(last, ancestors[i]) &&
+			matchAncestors(compounds[:len(compounds)-1], combinators[:len(combinators)-1], ancestors[:i]) {
+			return true
+		}
+		if combinator == '>' {
+			return false
+		}
+	}
+	return false
+}
+
+// splitCompound splits a compound selector, such as rect.a#b[fill],
+// into its simple selectors
+func splitCompound(compound string) []string {
+	var out []string
+	for compound != "" {
+		end := strings.IndexAny(compound[1:], ".#[:") + 1
+		if end == 0 {
+			end = len(compound)
+		}
+		if compound[0] == '[' {
+			if end = strings.IndexByte(compound, ']') + 1; end == 0 {
+				end = len(compound)
+			}
+		}
+		out = append(out, compound[:end])
+		compound = compound[end:]
+	}
+	return out
+}
+
+// matchCompound returns whether the element matches the compound selector
+func matchCompound(compound string, se xml.StartElement) bool {
+	attr := func(name string) (string, bool) {
+		for _, a := range se.Attr {
+			if a.Name.Local == name {
+				return a.Value, true
+			}
+		}
+		return "", false
+	}
+	for _, simple := range splitCompound(compound) {
+		switch simple[0] {
+		case '#':
+			if id, _ := attr("id"); id != simple[1:] {
+				return false
+			}
+		case '.':
+			class, _ := attr("class")
+			found := false
+			for _, c := range strings.Fields(class) {
+				found = found || c == simple[1:]
+			}
+			if !found {
+				return false
+			}
+		case '[':
+			name, value, hasValue := strings.Cut(strings.Trim(simple, "[]"), "=")
+			v, ok := attr(strings.TrimSpace(name))
+			if !ok || (hasValue && v != strings.Trim(strings.TrimSpace(value), `"'`)) {
+				return false
+			}
+		case ':':
+			return false // pseudo-classes are not supported
+		default:
+			if simple != "*" && simple != se.Name.Local {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,544 @@
+package svg
+
+// This file implements the CSS animations declared by the animation
+// properties and the @keyframes rules of the stylesheets. They are
+// added to the timeline of the SMIL animations.
+
+import (
+	"encoding/xml"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// cssAnimations holds the animation properties of an element,
+// each one being a list of values for the animations it names
+type cssAnimations struct {
+	names, durations, timings, delays, counts, directions, fills []string
+
+	origin string // transform-origin, applied to the animated transforms
+}
+
+// cssKeyframe is a keyframe of a @keyframes rule
+type cssKeyframe struct {
+	offset float64
+	decls  []cssDecl
+}
+
+// readCSSAnimations adds the CSS animations of the elements to the
+// timeline of the image
+func (c *svgCursor) readCSSAnimations() error {
+	var (
+		rules     []cssRule // rules with a selector
+		keyframes = make(map[string][]cssKeyframe)
+		inStyle   bool
+		text      strings.Builder
+	)
+	for _, t := range c.svg.doc.tokens {
+		switch t := t.(type) {
+		case xml.StartElement:
+			inStyle = t.Name.Local == "style"
+			text.Reset()
+		case xml.CharData:
+			if inStyle {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if !inStyle {
+				continue
+			}
+			inStyle = false
+			for _, rule := range parseCSS(text.String()) {
+				name, isKeyframes := cutKeyframesPrelude(rule.prelude)
+				switch {
+				case isKeyframes:
+					keyframes[name] = parseKeyframes(rule.rules)
+				case !strings.HasPrefix(rule.prelude, "@"):
+					rules = append(rules, rule)
+				}
+			}
+		}
+	}
+
+	var ancestors []xml.StartElement
+	for i, t := range c.svg.doc.tokens {
+		switch se := t.(type) {
+		case xml.StartElement:
+			anims := elementAnimations(rules, ancestors, se)
+			ancestors = append(ancestors, se)
+			for k, name := range anims.names {
+				frames, ok := keyframes[name]
+				if name == "none" || !ok {
+					continue
+				}
+				a, err := c.newCSSAnimation(anims, k, i, frames)
+				if err != nil {
+					return err
+				}
+				c.svg.Animations = append(c.svg.Animations, a...)
+			}
+		case xml.EndElement:
+			if n := len(ancestors); n > 0 {
+				ancestors = ancestors[:n-1]
+			}
+		}
+	}
+	return nil
+}
+
+// cutKeyframesPrelude returns the name of a @keyframes rule
+func cutKeyframesPrelude(prelude string) (string, bool) {
+	for _, keyword := range []string{"@keyframes", "@-webkit-keyframes", "@-moz-keyframes"} {
+		if name, ok := strings.CutPrefix(prelude, keyword+" "); ok {
+			return strings.Trim(strings.TrimSpace(name), `"'`), true
+		}
+	}
+	return "", false
+}
+
+// parseKeyframes returns the keyframes of a @keyframes
+// rule, sorted by offset
+func parseKeyframes(rules []cssRule) []cssKeyframe {
+	var frames []cssKeyframe
+	for _, rule := range rules {
+		for _, selector := range strings.Split(rule.prelude, ",") {
+			var offset float64
+			switch selector = strings.TrimSpace(selector); selector {
+			case "from":
+				offset = 0
+			case "to":
+				offset = 1
+			default:
+				f, err := strconv.ParseFloat(strings.TrimSuffix(selector, "%"), 64)
+				if err != nil || !strings.HasSuffix(selector, "%") || f < 0 || f > 100 {
+					continue
+				}
+				offset = f / 100
+			}
+			frames = append(frames, cssKeyframe{offset: offset, decls: rule.decls})
+		}
+	}
+	sort.SliceStable(frames, func(i, j int) bool { return frames[i].offset < frames[j].offset })
+	return frames
+}
+
+// elementAnimations returns the animation properties of the element, from
+// the rules matching it, by specificity, and from its style attribute
+func elementAnimations(rules []cssRule, ancestors []xml.StartElement, se xml.StartElement) cssAnimations {
+	type matched struct {
+		specificity int
+		decls       []cssDecl
+	}
+	var decls []matched
+	for _, rule := range rules {
+		if spec, ok := matchSelector(rule.prelude, ancestors, se); ok {
+			decls = append(decls, matched{specificity: spec, decls: rule.decls})
+		}
+	}
+	sort.SliceStable(decls, func(i, j int) bool { return decls[i].specificity < decls[j].specificity })
+	for _, attr := range se.Attr {
+		if attr.Name.Local == "style" {
+			decls = append(decls, matched{decls: parseDeclarations(attr.Value)})
+		}
+	}
+	var anims cssAnimations
+	for _, m := range decls {
+		for _, decl := range m.decls {
+			anims.set(decl.property, decl.value)
+		}
+	}
+	return anims
+}
+
+var timingKeywords = map[string]bool{
+	"linear": true, "ease": true, "ease-in": true, "ease-out": true,
+	"ease-in-out": true, "step-start": true, "step-end": true,
+}
+
+// set applies a declaration of an animation property
+func (a *cssAnimations) set(property, value string) {
+	items := splitCSSList(value, ',')
+	switch property {
+	case "animation":
+		*a = cssAnimations{origin: a.origin}
+		for _, item := range items {
+			// the values missing from an item are the initial ones
+			name, duration, timing, delay, count, direction, fill := "none", "0s", "ease", "0s", "1", "normal", "none"
+			seenDuration := false
+			for _, v := range splitCSSList(item, ' ') {
+				switch {
+				case isCSSTime(v):
+					if seenDuration {
+						delay = v
+					} else {
+						duration, seenDuration = v, true
+					}
+				case timingKeywords[v] || strings.HasPrefix(v, "cubic-bezier(") || strings.HasPrefix(v, "steps("):
+					timing = v
+				case v == "infinite" || isCSSNumber(v):
+					count = v
+				case v == "normal" || v == "reverse" || v == "alternate" || v == "alternate-reverse":
+					direction = v
+				case v == "forwards" || v == "backwards" || v == "both":
+					fill = v
+				case v == "running" || v == "paused":
+				default:
+					name = strings.Trim(v, `"'`)
+				}
+			}
+			a.names = append(a.names, name)
+			a.durations = append(a.durations, duration)
+			a.timings = append(a.timings, timing)
+			a.delays = append(a.delays, delay)
+			a.counts = append(a.counts, count)
+			a.directions = append(a.directions, direction)
+			a.fills = append(a.fills, fill)
+		}
+	case "animation-name":
+		a.names = items
+	case "animation-duration":
+		a.durations = items
+	case "animation-timing-function":
+		a.timings = items
+	case "animation-delay":
+		a.delays = items
+	case "animation-iteration-count":
+		a.counts = items
+	case "animation-direction":
+		a.directions = items
+	case "animation-fill-mode":
+		a.fills = items
+	case "transform-origin":
+		a.origin = value
+	}
+}
+
+// splitCSSList splits v on sep, outside of parentheses and strings
+func splitCSSList(v string, sep byte) []string {
+	var (
+		out   []string
+		sc    cssScanner
+		start int
+	)
+	add := func(item string) {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	for i := 0; i < len(v); i++ {
+		if sc.plain(v[i]) && (v[i] == sep || (sep == ' ' && (v[i] == '\t' || v[i] == '\n'))) {
+			add(v[start:i])
+			start = i + 1
+		}
+	}
+	add(v[start:])
+	return out
+}
+
+func isCSSTime(v string) bool {
+	number, ok := strings.CutSuffix(v, "ms")
+	if !ok {
+		number, ok = strings.CutSuffix(v, "s")
+	}
+	return ok && isCSSNumber(number)
+}
+
+func isCSSNumber(v string) bool {
+	_, err := strconv.ParseFloat(v, 64)
+	return err == nil
+}
+
+// cssListItem returns the k-th value of a list of animation
+// property values, which repeat as needed
+func cssListItem(values []string, k int, initial string) string {
+	if len(values) == 0 {
+		return initial
+	}
+	return values[k%len(values)]
+}
+
+// newCSSAnimation returns the animations, one for each property, of the
+// k-th animation of anims, applying the keyframes to the element se,
+// starting at the given token
+func (c *svgCursor) newCSSAnimation(anims cssAnimations, k, target int, frames []cssKeyframe) ([]*Animation, error) {
+	name := anims.names[k]
+	dur, err := parseClockValue(cssListItem(anims.durations, k, "0s"))
+	if err != nil {
+		return nil, c.handleError("invalid animation-duration of %s: %s", name, err)
+	}
+	delay, err := parseClockValue(cssListItem(anims.delays, k, "0s"))
+	if err != nil {
+		return nil, c.handleError("invalid animation-delay of %s: %s", name, err)
+	}
+	if dur <= 0 {
+		return nil, nil
+	}
+	var count float64
+	switch v := cssListItem(anims.counts, k, "1"); v {
+	case "infinite":
+		count = math.Inf(1)
+	default:
+		if count, err = strconv.ParseFloat(v, 64); err != nil || count <= 0 {
+			return nil, c.handleError("invalid animation-iteration-count of %s: %s", name, v)
+		}
+	}
+	timing := cssListItem(anims.timings, k, "ease")
+	fill := cssListItem(anims.fills, k, "none")
+	originX, originY, hasOrigin := transformOrigin(anims.origin)
+
+	// the properties of the keyframes, in the order they appear
+	var properties []string
+	seen := make(map[string]bool)
+	for _, frame := range frames {
+		for _, decl := range frame.decls {
+			if !seen[decl.property] && decl.property != "animation-timing-function" {
+				seen[decl.property] = true
+				properties = append(properties, decl.property)
+			}
+		}
+	}
+	var out []*Animation
+	for _, property := range properties {
+		a := &Animation{
+			Element:     "animate",
+			Keyframes:   name,
+			Attribute:   property,
+			Dur:         dur,
+			RepeatCount: count,
+			Begin:       []TimingValue{{Offset: delay}},
+			Freeze:      fill == "forwards" || fill == "both",
+			target:      target,
+			direction:   cssListItem(anims.directions, k, "normal"),
+			backwards:   fill == "backwards" || fill == "both",
+		}
+		var easings []string // timing functions of the keyframes
+		for _, frame := range frames {
+			value, frameTiming, ok := timing, "", false
+			for _, decl := range frame.decls {
+				switch decl.property {
+				case property:
+					value, ok = decl.value, true
+				case "animation-timing-function":
+					frameTiming = decl.value
+				}
+			}
+			if !ok {
+				continue
+			}
+			if property == "transform" {
+				value = cssTransform(value)
+			}
+			if frameTiming == "" {
+				frameTiming = timing
+			}
+			// a keyframe replaces the previous one at the same offset
+			if n := len(a.KeyTimes); n > 0 && a.KeyTimes[n-1] == frame.offset {
+				a.Values, a.KeyTimes, easings = a.Values[:n-1], a.KeyTimes[:n-1], easings[:n-1]
+			}
+			a.Values = append(a.Values, value)
+			a.KeyTimes = append(a.KeyTimes, frame.offset)
+			easings = append(easings, frameTiming)
+		}
+		// the missing first and last keyframes have the value of the element,
+		// or the identity transform which interpolates with the other ones
+		first, last := "", ""
+		if property == "transform" && len(a.Values) > 0 {
+			first, last = identityTransform(a.Values[0]), identityTransform(a.Values[len(a.Values)-1])
+		}
+		if len(a.KeyTimes) == 0 || a.KeyTimes[0] != 0 {
+			a.Values = append([]string{first}, a.Values...)
+			a.KeyTimes = append([]float64{0}, a.KeyTimes...)
+			easings = append([]string{timing}, easings...)
+		}
+		if a.KeyTimes[len(a.KeyTimes)-1] != 1 {
+			a.Values = append(a.Values, last)
+			a.KeyTimes = append(a.KeyTimes, 1)
+			easings = append(easings, timing)
+		}
+		if property == "transform" && hasOrigin {
+			for i, value := range a.Values {
+				if value != "" {
+					a.Values[i] = "translate(" + formatNumber(originX) + "," + formatNumber(originY) + ") " + value +
+						" translate(" + formatNumber(-originX) + "," + formatNumber(-originY) + ")"
+				}
+			}
+		}
+		for _, e := range easings {
+			a.easings = append(a.easings, parseTimingFunction(e))
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// parseTimingFunction returns the easing function described by v,
+// which is linear if v is not supported
+func parseTimingFunction(v string) func(float64) float64 {
+	bezier := func(x1, y1, x2, y2 float64) func(float64) float64 {
+		return func(x float64) float64 { return splineEasing([4]float64{x1, y1, x2, y2}, x) }
+	}
+	switch v {
+	case "ease":
+		return bezier(0.25, 0.1, 0.25, 1)
+	case "ease-in":
+		return bezier(0.42, 0, 1, 1)
+	case "ease-out":
+		return bezier(0, 0, 0.58, 1)
+	case "ease-in-out":
+		return bezier(0.42, 0, 0.58, 1)
+	case "step-start":
+		return steps(1, "start")
+	case "step-end":
+		return steps(1, "end")
+	}
+	name, args, ok := strings.Cut(strings.TrimSuffix(v, ")"), "(")
+	if !ok {
+		return nil
+	}
+	params := splitCSSList(args, ',')
+	switch name {
+	case "cubic-bezier":
+		if len(params) != 4 {
+			return nil
+		}
+		var p [4]float64
+		for i, param := range params {
+			f, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return nil
+			}
+			p[i] = f
+		}
+		return bezier(p[0], p[1], p[2], p[3])
+	case "steps":
+		n, err := strconv.Atoi(params[0])
+		if err != nil || n < 1 {
+			return nil
+		}
+		position := "end"
+		if len(params) > 1 {
+			position = params[1]
+		}
+		return steps(n, position)
+	}
+	return nil
+}
+
+// steps returns the step easing function with n
+// steps, jumping at the given position
+func steps(n int, position string) func(float64) float64 {
+	return func(x float64) float64 {
+		step, jumps := math.Floor(x*float64(n)), float64(n)
+		switch position {
+		case "start", "jump-start":
+			step++
+		case "jump-none":
+			jumps = math.Max(1, jumps-1)
+		case "jump-both":
+			step++
+			jumps++
+		}
+		if x >= 1 {
+			step = jumps
+		}
+		return math.Min(1, step/jumps)
+	}
+}
+
+var cssTransformRe = regexp.MustCompile(`([a-zA-Z]+)\s*\(([^)]*)\)`)
+
+// cssTransform converts the CSS transform v to the syntax of the
+// transform attribute
+func cssTransform(v string) string {
+	var out []string
+	for _, m := range cssTransformRe.FindAllStringSubmatch(v, -1) {
+		args := splitOnCommaOrSpace(m[2])
+		for i, arg := range args {
+			args[i] = cssAngleOrLength(arg)
+		}
+		arg := func(i int, def string) string {
+			if i < len(args) {
+				return args[i]
+			}
+			return def
+		}
+		switch name := m[1]; name {
+		case "translateX":
+			out = append(out, "translate("+arg(0, "0")+",0)")
+		case "translateY":
+			out = append(out, "translate(0,"+arg(0, "0")+")")
+		case "translate":
+			out = append(out, "translate("+arg(0, "0")+","+arg(1, "0")+")")
+		case "scaleX":
+			out = append(out, "scale("+arg(0, "1")+",1)")
+		case "scaleY":
+			out = append(out, "scale(1,"+arg(0, "1")+")")
+		case "scale":
+			out = append(out, "scale("+arg(0, "1")+","+arg(1, arg(0, "1"))+")")
+		case "rotate", "rotateZ":
+			out = append(out, "rotate("+arg(0, "0")+")")
+		case "skew":
+			out = append(out, "skewX("+arg(0, "0")+") skewY("+arg(1, "0")+")")
+		case "skewX", "skewY", "matrix":
+			out = append(out, name+"("+strings.Join(args, ",")+")")
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// identityTransform returns the transform list v, converted by
+// cssTransform, with the arguments of the identity transform
+func identityTransform(v string) string {
+	return cssTransformRe.ReplaceAllStringFunc(v, func(f string) string {
+		name, _, _ := strings.Cut(f, "(")
+		switch name {
+		case "scale":
+			return "scale(1,1)"
+		case "matrix":
+			return "matrix(1,0,0,1,0,0)"
+		case "translate":
+			return "translate(0,0)"
+		}
+		return name + "(0)"
+	})
+}
+
+// cssAngleOrLength returns the number of an angle, in degrees, or
+// of a length in pixels, so that it fits in a transform attribute
+func cssAngleOrLength(v string) string {
+	for _, u := range []struct {
+		unit   string
+		factor float64
+	}{{"deg", 1}, {"grad", 0.9}, {"rad", 180 / math.Pi}, {"turn", 360}, {"px", 1}} {
+		if number, ok := strings.CutSuffix(v, u.unit); ok {
+			if f, err := strconv.ParseFloat(number, 64); err == nil {
+				return formatNumber(f * u.factor)
+			}
+		}
+	}
+	return v
+}
+
+// transformOrigin returns the transform-origin v, if it is given in
+// user units. Percentages and keywords, which depend on the reference
+// box, are not supported.
+func transformOrigin(v string) (x, y float64, ok bool) {
+	fields := splitOnCommaOrSpace(v)
+	if len(fields) == 0 || len(fields) > 3 {
+		return 0, 0, false
+	}
+	var coords [2]float64
+	for i := range coords {
+		if i >= len(fields) {
+			break
+		}
+		f, err := strconv.ParseFloat(cssAngleOrLength(fields[i]), 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		coords[i] = f
+	}
+	return coords[0], coords[1], coords != [2]float64{}
+}
@@ -0,0 +1,54 @@
+package svg
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var errNotDataURI = errors.New("not a data URI")
+
+// decodeDataURI returns the media type and the content of a data URI,
+// such as "data:font/ttf;base64,AAEAAA..."
+func decodeDataURI(uri string) (mediaType string, data []byte, err error) {
+	uri = strings.TrimSpace(uri)
+	if len(uri) < 5 || !strings.EqualFold(uri[:5], "data:") {
+		return "", nil, errNotDataURI
+	}
+	header, content, ok := strings.Cut(uri[5:], ",")
+	if !ok {
+		return "", nil, errNotDataURI
+	}
+	params := strings.Split(header, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(params[0]))
+	isBase64 := false
+	for _, p := range params[1:] {
+		if strings.EqualFold(strings.TrimSpace(p), "base64") {
+			isBase64 = true
+		}
+	}
+	if !isBase64 {
+		s, err := url.PathUnescape(content)
+		return mediaType, []byte(s), err
+	}
+	// base64 content may be split on several lines, or be percent encoded
+	if strings.Contains(content, "%") {
+		if content, err = url.PathUnescape(content); err != nil {
+			return "", nil, err
+		}
+	}
+	content = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\n', '\r':
+			return -1
+		}
+		return r
+	}, content)
+	data, err = base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		// some encoders omit the padding
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(content, "="))
+	}
+	return mediaType, data, err
+}
@@ -0,0 +1,403 @@
+package svg
+
+// This file defines how fonts are looked up when rendering text elements.
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// FontStyle is the type for the font-style property
+type FontStyle uint8
+
+// SVG font-style constants
+const (
+	FontStyleNormal FontStyle = iota
+	FontStyleItalic
+	FontStyleOblique
+)
+
+func (s FontStyle) String() string {
+	switch s {
+	case FontStyleNormal:
+		return "normal"
+	case FontStyleItalic:
+		return "italic"
+	case FontStyleOblique:
+		return "oblique"
+	default:
+		return "<unknown FontStyle>"
+	}
+}
+
+// FontProvider resolves the fonts used to render text elements.
+type FontProvider interface {
+	// Font returns the font best matching the given family, weight (100 to 900)
+	// and style, or nil if the family is not available.
+	// An empty family asks for the default font of the provider.
+	Font(family string, weight int, style FontStyle) *sfnt.Font
+}
+
+type fontFace struct {
+	family string // lower cased family name
+	weight int
+	style  FontStyle
+	font   *sfnt.Font
+}
+
+// FontCollection is a FontProvider serving a fixed set of fonts.
+// The first family added is used as the default font.
+type FontCollection struct {
+	faces []fontFace
+}
+
+// NewFontCollection returns an empty font collection.
+func NewFontCollection() *FontCollection {
+	return &FontCollection{}
+}
+
+// Add registers a parsed font under the given family, weight and style.
+func (fc *FontCollection) Add(family string, weight int, style FontStyle, f *sfnt.Font) {
+	fc.faces = append(fc.faces, fontFace{
+		family: strings.ToLower(strings.TrimSpace(family)),
+		weight: weight,
+		style:  style,
+		font:   f,
+	})
+}
+
+// AddFont parses the given TrueType, OpenType or WOFF data and registers
+// it using the family and subfamily names stored in the font.
+func (fc *FontCollection) AddFont(data []byte) error {
+	f, err := parseFont(data)
+	if err != nil {
+		return err
+	}
+	var buf sfnt.Buffer
+	family, err := f.Name(&buf, sfnt.NameIDTypographicFamily)
+	if err != nil || family == "" {
+		if family, err = f.Name(&buf, sfnt.NameIDFamily); err != nil {
+			return err
+		}
+	}
+	subfamily, err := f.Name(&buf, sfnt.NameIDTypographicSubfamily)
+	if err != nil || subfamily == "" {
+		subfamily, _ = f.Name(&buf, sfnt.NameIDSubfamily)
+	}
+	weight, style := parseSubfamily(subfamily)
+	fc.Add(family, weight, style, f)
+	return nil
+}
+
+// LoadFontDir returns a collection holding every TrueType, OpenType
+// and WOFF font found in dir and its sub directories.
+// The files which cannot be read or parsed are skipped: the collection
+// then holds the other fonts, and the error joins the errors of each file.
+func LoadFontDir(dir string) (*FontCollection, error) {
+	fc := NewFontCollection()
+	var errs []error
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			errs = append(errs, err)
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ttf", ".otf", ".woff":
+		default:
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = fc.AddFont(data)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fc, errors.Join(errs...)
+}
+
+// Font implements FontProvider. Among the faces of the family, a matching
+// style is preferred over a matching weight.
+func (fc *FontCollection) Font(family string, weight int, style FontStyle) *sfnt.Font {
+	if len(fc.faces) == 0 {
+		return nil
+	}
+	family = strings.ToLower(strings.TrimSpace(family))
+	if family == "" {
+		family = fc.faces[0].family
+	}
+	var (
+		best      *sfnt.Font
+		bestScore int
+	)
+	for _, face := range fc.faces {
+		if face.family != family {
+			continue
+		}
+		score := face.weight - weight
+		if score < 0 {
+			score = -score
+		}
+		if face.style != style {
+			score += 1000
+		}
+		if best == nil || score < bestScore {
+			best, bestScore = face.font, score
+		}
+	}
+	return best
+}
+
+// parseFont parses TrueType, OpenType or WOFF data
+func parseFont(data []byte) (*sfnt.Font, error) {
+	if len(data) >= 4 {
+		switch string(data[:4]) {
+		case "wOFF":
+			var err error
+			if data, err = decodeWOFF(data); err != nil {
+				return nil, err
+			}
+		case "wOF2":
+			return nil, errors.New("WOFF2 fonts are not supported")
+		}
+	}
+	return sfnt.Parse(data)
+}
+
+// decodeWOFF rebuilds the OpenType font wrapped in WOFF 1.0 data
+func decodeWOFF(data []byte) ([]byte, error) {
+	const (
+		headerSize = 44
+		entrySize  = 20
+		// zlib cannot expand data more than 1032 times
+		maxExpansion = 1032
+		// larger fonts are not allocated, whatever their data
+		maxFontSize = 64 << 20
+	)
+	if len(data) < headerSize {
+		return nil, errors.New("invalid WOFF header")
+	}
+	be := binary.BigEndian
+	flavor := be.Uint32(data[4:])
+	numTables := int(be.Uint16(data[12:]))
+	if len(data) < headerSize+numTables*entrySize {
+		return nil, errors.New("invalid WOFF table directory")
+	}
+	// the size of the font is not trusted before allocating it
+	dirSize := 12 + 16*numTables
+	totalSize := uint64(be.Uint32(data[16:]))
+	if totalSize < uint64(dirSize) || totalSize > uint64(dirSize)+maxExpansion*uint64(len(data)) || totalSize > maxFontSize {
+		return nil, fmt.Errorf("invalid WOFF font size %d", totalSize)
+	}
+
+	// offset table, followed by the table records
+	out := make([]byte, dirSize, totalSize)
+	be.PutUint32(out[0:], flavor)
+	be.PutUint16(out[4:], uint16(numTables))
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= numTables {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+	be.PutUint16(out[6:], uint16(searchRange))
+	be.PutUint16(out[8:], uint16(entrySelector))
+	be.PutUint16(out[10:], uint16(numTables*16-searchRange))
+
+	for i := 0; i < numTables; i++ {
+		entry := data[headerSize+i*entrySize:]
+		offset, compLength, origLength := be.Uint32(entry[4:]), be.Uint32(entry[8:]), be.Uint32(entry[12:])
+		if uint64(offset)+uint64(compLength) > uint64(len(data)) || compLength > origLength ||
+			uint64(len(out))+uint64(origLength) > totalSize {
+			return nil, fmt.Errorf("invalid WOFF table %q", entry[:4])
+		}
+		table := data[offset : offset+compLength]
+		if compLength < origLength {
+			r, err := zlib.NewReader(bytes.NewReader(table))
+			if err != nil {
+				return nil, err
+			}
+			table = make([]byte, origLength)
+			if _, err = io.ReadFull(r, table); err != nil {
+				return nil, err
+			}
+		}
+		record := out[12+16*i:]
+		copy(record[0:4], entry[:4])                    // tag
+		be.PutUint32(record[4:], be.Uint32(entry[16:])) // checksum
+		be.PutUint32(record[8:], uint32(len(out)))
+		be.PutUint32(record[12:], origLength)
+		out = append(out, table...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	return out, nil
+}
+
+// readFontFace registers the font of a @font-face rule whose
+// source is a data URI. Other sources are ignored.
+func (c *svgCursor) readFontFace(decls []cssDecl) error {
+	var (
+		family string
+		weight = 400
+		style  FontStyle
+		srcs   []string
+	)
+	for _, d := range decls {
+		// variable fonts give ranges, such as "100 900"
+		first := ""
+		if fields := strings.Fields(d.value); len(fields) > 0 {
+			first = fields[0]
+		}
+		switch d.property {
+		case "font-family":
+			family = strings.Trim(d.value, `"'`)
+		case "font-weight":
+			if w, err := parseFontWeight(first, 400); err == nil {
+				weight = w
+			}
+		case "font-style":
+			switch first {
+			case "italic":
+				style = FontStyleItalic
+			case "oblique":
+				style = FontStyleOblique
+			}
+		case "src":
+			srcs = cssURLs(d.value)
+		}
+	}
+	if family == "" {
+		return nil
+	}
+	var lastErr error
+	for _, src := range srcs {
+		_, data, err := decodeDataURI(src)
+		if err == errNotDataURI {
+			continue
+		}
+		if err == nil {
+			var f *sfnt.Font
+			if f, err = parseFont(data); err == nil {
+				c.embeddedFonts.Add(family, weight, style, f)
+				return nil
+			}
+		}
+		lastErr = err
+	}
+	if lastErr != nil {
+		return c.handleError("cannot load font %q of @font-face: %s", family, lastErr)
+	}
+	return nil
+}
+
+// parseSubfamily guesses the weight and style of a font from its
+// subfamily name, such as "Bold Italic".
+func parseSubfamily(subfamily string) (weight int, style FontStyle) {
+	s := strings.ReplaceAll(strings.ToLower(subfamily), " ", "")
+	switch {
+	case strings.Contains(s, "thin") || strings.Contains(s, "hairline"):
+		weight = 100
+	case strings.Contains(s, "extralight") || strings.Contains(s, "ultralight"):
+		weight = 200
+	case strings.Contains(s, "semibold") || strings.Contains(s, "demibold"):
+		weight = 600
+	case strings.Contains(s, "extrabold") || strings.Contains(s, "ultrabold"):
+		weight = 800
+	case strings.Contains(s, "black") || strings.Contains(s, "heavy"):
+		weight = 900
+	case strings.Contains(s, "light"):
+		weight = 300
+	case strings.Contains(s, "medium"):
+		weight = 500
+	case strings.Contains(s, "bold"):
+		weight = 700
+	default:
+		weight = 400
+	}
+	switch {
+	case strings.Contains(s, "italic"):
+		style = FontStyleItalic
+	case strings.Contains(s, "oblique"):
+		style = FontStyleOblique
+	}
+	return weight, style
+}
+
+// lookupFont returns the font to use for the given font options,
+// trying each family of the font-family list in turn before falling
+// back to the default font of the provider. Fonts embedded with
+// @font-face rules take precedence over the provider.
+func (c *svgCursor) lookupFont(opts FontOptions) *sfnt.Font {
+	key := fontKey{family: opts.Family, weight: opts.Weight, style: opts.Style}
+	if f, ok := c.fontCache[key]; ok {
+		return f
+	}
+	var providers []FontProvider
+	if c.embeddedFonts != nil {
+		providers = append(providers, c.embeddedFonts)
+	}
+	if c.fonts != nil {
+		providers = append(providers, c.fonts)
+	}
+	var f *sfnt.Font
+	for _, family := range splitFontFamily(opts.Family) {
+		if f = fontFrom(providers, family, opts); f != nil {
+			break
+		}
+	}
+	if f == nil {
+		// the default font of the provider is preferred over an embedded font
+		for i := len(providers) - 1; i >= 0 && f == nil; i-- {
+			f = providers[i].Font("", opts.Weight, opts.Style)
+		}
+	}
+	c.fontCache[key] = f
+	return f
+}
+
+// fontFrom returns the font of the first provider serving the family
+func fontFrom(providers []FontProvider, family string, opts FontOptions) *sfnt.Font {
+	for _, p := range providers {
+		if f := p.Font(family, opts.Weight, opts.Style); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+type fontKey struct {
+	family string
+	weight int
+	style  FontStyle
+}
+
+// splitFontFamily splits a font-family list into unquoted family names
+func splitFontFamily(v string) []string {
+	var families []string
+	for _, f := range strings.Split(v, ",") {
+		f = strings.Trim(strings.TrimSpace(f), `"'`)
+		if f != "" {
+			families = append(families, f)
+		}
+	}
+	return families
+}
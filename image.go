@@ -0,0 +1,147 @@
+package svg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image"
+
+	// image formats supported by the image element
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
+	"golang.org/x/image/math/fixed"
+)
+
+// SvgImage is a raster image, drawn in the viewport given by X, Y, W and H.
+type SvgImage struct {
+	Image       image.Image
+	X, Y, W, H  float64
+	AspectRatio AspectRatio // preserveAspectRatio
+	Style       PathStyle
+
+	// Index is the position of the image in the drawing order:
+	// it is drawn after SvgPaths[Index-1], and before SvgPaths[Index].
+	Index int
+}
+
+// Matrix returns the transform of the image pixels to the user space.
+func (img *SvgImage) Matrix() Matrix2D {
+	size := img.Image.Bounds()
+	box := Bounds{X: float64(size.Min.X), Y: float64(size.Min.Y), W: float64(size.Dx()), H: float64(size.Dy())}
+	return img.AspectRatio.Transform(box, Bounds{X: img.X, Y: img.Y, W: img.W, H: img.H})
+}
+
+// Visible returns the part of the image shown in its viewport, in user space.
+func (img *SvgImage) Visible() Bounds {
+	m := img.Matrix()
+	size := img.Image.Bounds()
+	x0, y0 := m.Transform(float64(size.Min.X), float64(size.Min.Y))
+	x1, y1 := m.Transform(float64(size.Max.X), float64(size.Max.Y))
+	if x0 < img.X {
+		x0 = img.X
+	}
+	if y0 < img.Y {
+		y0 = img.Y
+	}
+	if x1 > img.X+img.W {
+		x1 = img.X + img.W
+	}
+	if y1 > img.Y+img.H {
+		y1 = img.Y + img.H
+	}
+	if x1 < x0 || y1 < y0 {
+		return Bounds{X: x0, Y: y0}
+	}
+	return Bounds{X: x0, Y: y0, W: x1 - x0, H: y1 - y0}
+}
+
+// Path returns the outline of the visible part of the image, in user space.
+func (img *SvgImage) Path() Path {
+	b := img.Visible()
+	var p Path
+	p.Start(fixed.Point26_6{X: fToFixed(b.X), Y: fToFixed(b.Y)})
+	p.Line(fixed.Point26_6{X: fToFixed(b.X + b.W), Y: fToFixed(b.Y)})
+	p.Line(fixed.Point26_6{X: fToFixed(b.X + b.W), Y: fToFixed(b.Y + b.H)})
+	p.Line(fixed.Point26_6{X: fToFixed(b.X), Y: fToFixed(b.Y + b.H)})
+	p.Stop(true)
+	return p
+}
+
+func imageF(c *svgCursor, attrs []xml.Attr) error {
+	var (
+		img        SvgImage
+		href       string
+		hasW, hasH bool
+		err        error
+	)
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "href":
+			href = attr.Value
+		case "x":
+			img.X, err = c.parseUnit(attr.Value, widthPercentage)
+		case "y":
+			img.Y, err = c.parseUnit(attr.Value, heightPercentage)
+		case "width":
+			img.W, err = c.parseUnit(attr.Value, widthPercentage)
+			hasW = true
+		case "height":
+			img.H, err = c.parseUnit(attr.Value, heightPercentage)
+			hasH = true
+		case "preserveAspectRatio":
+			img.AspectRatio, err = parseAspectRatio(attr.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if c.clip != nil || c.pattern != nil || c.inMask {
+		return c.handleError("images are not supported in clip paths, patterns and masks")
+	}
+	_, data, err := decodeDataURI(href)
+	if err == errNotDataURI {
+		name, _ := c.splitRef(href)
+		data, err = c.readResource(name)
+	}
+	if err != nil {
+		return c.handleError("cannot load image %q: %s", truncate(href), err)
+	}
+	img.Image, _, err = image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return c.handleError("cannot decode image: %s", err)
+	}
+	// a missing width or height is the one of the image
+	size := img.Image.Bounds()
+	if !hasW {
+		img.W = float64(size.Dx())
+	}
+	if !hasH {
+		img.H = float64(size.Dy())
+	}
+	if img.W <= 0 || img.H <= 0 || size.Empty() {
+		return nil
+	}
+	img.Style = c.styleStack[len(c.styleStack)-1]
+	for _, ref := range img.Style.ClipPaths {
+		ref.extend(img.Path(), img.Style.Transform)
+	}
+	if img.Style.invisible {
+		return nil
+	}
+	img.Index = len(c.svg.SvgPaths)
+	c.svg.Images = append(c.svg.Images, img)
+	return nil
+}
+
+// truncate shortens s, used in error messages
+func truncate(s string) string {
+	if len(s) > 32 {
+		return s[:32] + "..."
+	}
+	return s
+}
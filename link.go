@@ -0,0 +1,82 @@
+package svg
+
+import (
+	"encoding/xml"
+	"math"
+)
+
+// Link is the target of an a element, shared by the elements it contains.
+type Link struct {
+	Href   string
+	Target string // target attribute, such as "_blank"
+}
+
+// LinkRegion is the area covered by an element drawn inside an a element.
+type LinkRegion struct {
+	Link   *Link
+	Bounds Bounds // bounding box of the element, in device coordinates
+}
+
+// aF starts a hyperlink, which is drawn as a group
+func aF(c *svgCursor, attrs []xml.Attr) error {
+	link := &Link{}
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "href":
+			link.Href = attr.Value
+		case "target":
+			link.Target = attr.Value
+		}
+	}
+	c.styleStack[len(c.styleStack)-1].Link = link
+	return nil
+}
+
+// LinkRegions returns the regions covered by the paths and images inside
+// a elements, in drawing order, once transformed by m. With the renderer
+// package, m is the Target of the RenderOptions. A link covering several
+// elements has several regions, as in HTML image maps.
+func (s *Svg) LinkRegions(m Matrix2D) []LinkRegion {
+	var regions []LinkRegion
+	images := s.Images
+	addImages := func(index int) {
+		for len(images) > 0 && images[0].Index <= index {
+			img := &images[0]
+			if img.Style.Link != nil {
+				v := img.Visible()
+				var p Path
+				p.addRect(v.X, v.Y, v.X+v.W, v.Y+v.H, 0)
+				if b, ok := transformedBounds(p, m.Mult(img.Style.Transform)); ok {
+					regions = append(regions, LinkRegion{Link: img.Style.Link, Bounds: b})
+				}
+			}
+			images = images[1:]
+		}
+	}
+	for i, p := range s.SvgPaths {
+		addImages(i)
+		if p.Style.Link == nil {
+			continue
+		}
+		if b, ok := transformedBounds(p.Path, m.Mult(p.Style.Transform)); ok {
+			regions = append(regions, LinkRegion{Link: p.Style.Link, Bounds: b})
+		}
+	}
+	addImages(len(s.SvgPaths))
+	return regions
+}
+
+// transformedBounds returns the bounding box of the path transformed by m,
+// and false if the path is empty
+func transformedBounds(p Path, m Matrix2D) (Bounds, bool) {
+	pl := flattenPath(p, m)
+	if len(pl) == 0 {
+		return Bounds{}, false
+	}
+	minX, minY, maxX, maxY := pl[0].x, pl[0].y, pl[0].x, pl[0].y
+	for _, pt := range pl[1:] {
+		minX, maxX = math.Min(minX, pt.x), math.Max(maxX, pt.x)
+		minY, maxY = math.Min(minY, pt.y), math.Max(maxY, pt.y)
+	}
+	return Bounds{X: minX, Y: minY, W: maxX - minX, H: maxY - minY}, true
+}
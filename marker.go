@@ -0,0 +1,289 @@
+package svg
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/math/fixed"
+)
+
+// markerVertex is a vertex of a path, where markers are placed
+type markerVertex struct {
+	x, y          float64
+	in, out       float64 // angles of the directions of the path at the vertex
+	hasIn, hasOut bool
+}
+
+// angle returns the direction of a marker with orient="auto"
+func (v markerVertex) angle() float64 {
+	switch {
+	case v.hasIn && v.hasOut:
+		// bisect the incoming and outgoing directions
+		return math.Atan2(math.Sin(v.in)+math.Sin(v.out), math.Cos(v.in)+math.Cos(v.out))
+	case v.hasIn:
+		return v.in
+	default:
+		return v.out
+	}
+}
+
+// direction returns the angle of the vector from (x1, y1) to
+// (x2, y2), and false if it is empty
+func direction(x1, y1, x2, y2 float64) (float64, bool) {
+	if x1 == x2 && y1 == y2 {
+		return 0, false
+	}
+	return math.Atan2(y2-y1, x2-x1), true
+}
+
+// markerVertices returns the vertices of the path, with the directions
+// of the segments starting and ending on them
+func markerVertices(p Path) []markerVertex {
+	var (
+		vertices   []markerVertex
+		startIndex int     // vertex starting the current sub path
+		x, y       float64 // current point
+	)
+	toFloat := func(p fixed.Point26_6) (float64, float64) { return float64(p.X) / 64, float64(p.Y) / 64 }
+	// addSegment adds the vertex ending a segment, given the
+	// control points defining its directions at both ends
+	addSegment := func(points ...float64) {
+		last := &vertices[len(vertices)-1]
+		n := len(points)
+		ex, ey := points[n-2], points[n-1]
+		v := markerVertex{x: ex, y: ey}
+		for i := 0; i < n && !last.hasOut; i += 2 {
+			last.out, last.hasOut = direction(x, y, points[i], points[i+1])
+		}
+		v.in, v.hasIn = direction(x, y, ex, ey)
+		for i := n - 4; i >= 0; i -= 2 {
+			if in, ok := direction(points[i], points[i+1], ex, ey); ok {
+				v.in, v.hasIn = in, true
+				break
+			}
+		}
+		vertices = append(vertices, v)
+		x, y = ex, ey
+	}
+	for _, op := range p {
+		switch op := op.(type) {
+		case OpMoveTo:
+			x, y = toFloat(fixed.Point26_6(op))
+			startIndex = len(vertices)
+			vertices = append(vertices, markerVertex{x: x, y: y})
+		case OpLineTo:
+			ex, ey := toFloat(fixed.Point26_6(op))
+			addSegment(ex, ey)
+		case OpQuadTo:
+			cx, cy := toFloat(op[0])
+			ex, ey := toFloat(op[1])
+			addSegment(cx, cy, ex, ey)
+		case OpCubicTo:
+			c1x, c1y := toFloat(op[0])
+			c2x, c2y := toFloat(op[1])
+			ex, ey := toFloat(op[2])
+			addSegment(c1x, c1y, c2x, c2y, ex, ey)
+		case OpClose:
+			if len(vertices) == 0 {
+				continue
+			}
+			start := &vertices[startIndex]
+			addSegment(start.x, start.y)
+			// the closing vertex, and the start of the sub path,
+			// join the closing segment with the first one
+			end := &vertices[len(vertices)-1]
+			end.out, end.hasOut = start.out, start.hasOut
+			if end.hasIn {
+				start.in, start.hasIn = end.in, true
+			}
+		}
+	}
+	return vertices
+}
+
+// marker is a marker element, referenced by marker properties
+type marker struct {
+	id                     string
+	attrs                  []xml.Attr
+	content                []xml.Token
+	refX, refY             float64
+	width, height          float64 // markerWidth and markerHeight
+	box                    Bounds  // viewBox
+	aspectRatio            AspectRatio
+	strokeWidthUnits       bool
+	autoOrient, autoRevert bool
+	angle                  float64 // fixed orientation, in radians
+	clip                   bool
+}
+
+// markerF starts a marker: like the content of
+// defs, markers are only drawn by the paths using them.
+func markerF(c *svgCursor, attrs []xml.Attr) error {
+	c.hidden++
+	return nil
+}
+
+// lookupMarker returns the marker element with the given id
+func (c *svgCursor) lookupMarker(id string) (*marker, error) {
+	tokens, ok := c.svg.doc.lookup(id)
+	if !ok || tokens[0].(xml.StartElement).Name.Local != "marker" {
+		return nil, c.handleError("marker %s not found", id)
+	}
+	se := tokens[0].(xml.StartElement)
+	m := &marker{
+		id:               id,
+		attrs:            se.Attr,
+		content:          tokens[1 : len(tokens)-1],
+		width:            3,
+		height:           3,
+		strokeWidthUnits: true,
+		clip:             true,
+	}
+	var err error
+	for _, attr := range se.Attr {
+		switch attr.Name.Local {
+		case "refX":
+			m.refX, err = c.parseUnit(attr.Value, widthPercentage)
+		case "refY":
+			m.refY, err = c.parseUnit(attr.Value, heightPercentage)
+		case "markerWidth":
+			m.width, err = c.parseUnit(attr.Value, widthPercentage)
+		case "markerHeight":
+			m.height, err = c.parseUnit(attr.Value, heightPercentage)
+		case "viewBox":
+			m.box, err = c.parseViewBox(attr.Value)
+		case "preserveAspectRatio":
+			m.aspectRatio, err = parseAspectRatio(attr.Value)
+		case "markerUnits":
+			m.strokeWidthUnits = attr.Value != "userSpaceOnUse"
+		case "overflow":
+			m.clip = attr.Value != "visible" && attr.Value != "auto"
+		case "orient":
+			switch v := strings.TrimSpace(attr.Value); v {
+			case "auto":
+				m.autoOrient = true
+			case "auto-start-reverse":
+				m.autoOrient, m.autoRevert = true, true
+			default:
+				m.angle, err = parseAngle(v)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// parseAngle parses an angle, in degrees unless given in an other unit
+func parseAngle(v string) (float64, error) {
+	units := []struct {
+		suffix string
+		scale  float64
+	}{{"deg", math.Pi / 180}, {"grad", math.Pi / 200}, {"rad", 1}, {"turn", 2 * math.Pi}, {"", math.Pi / 180}}
+	for _, u := range units {
+		if s, ok := strings.CutSuffix(v, u.suffix); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			return f * u.scale, err
+		}
+	}
+	return 0, fmt.Errorf("invalid angle %q", v)
+}
+
+// placeMarkers draws the markers of the style on the
+// vertices of the path, which was just drawn
+func (c *svgCursor) placeMarkers(p Path, style PathStyle) error {
+	if style.MarkerStart == "" && style.MarkerMid == "" && style.MarkerEnd == "" {
+		return nil
+	}
+	vertices := markerVertices(p)
+	if len(vertices) == 0 {
+		return nil
+	}
+	// each marker is read once, even if missing
+	markers := make(map[string]*marker, 3)
+	for i, v := range vertices {
+		id, start := style.MarkerMid, false
+		switch i {
+		case 0:
+			id, start = style.MarkerStart, true
+		case len(vertices) - 1:
+			id = style.MarkerEnd
+		}
+		if id == "" {
+			continue
+		}
+		m, ok := markers[id]
+		if !ok {
+			var err error
+			if m, err = c.lookupMarker(id); err != nil {
+				return err
+			}
+			markers[id] = m
+		}
+		if m == nil {
+			continue
+		}
+		if err := c.drawMarker(m, v, start, style); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drawMarker draws the marker on the vertex of a path with the given style
+func (c *svgCursor) drawMarker(m *marker, v markerVertex, start bool, context PathStyle) error {
+	if err := c.res.push("#"+m.id, false); err != nil {
+		return c.handleError("%s", err)
+	}
+	defer c.res.pop()
+
+	angle := m.angle
+	if m.autoOrient {
+		angle = v.angle()
+		if start && m.autoRevert {
+			angle += math.Pi
+		}
+	}
+	// the user space of the marker viewport is placed
+	// on the vertex, along the direction of the path
+	transform := context.Transform.Mult(Identity.Translate(v.x, v.y)).Mult(Identity.Rotate(angle))
+	if m.strokeWidthUnits {
+		transform = transform.Mult(Identity.Scale(context.LineWidth, context.LineWidth))
+	}
+	viewport := Bounds{W: m.width, H: m.height}
+	box := m.box
+	if box.W <= 0 || box.H <= 0 {
+		box = viewport
+	}
+	content := m.aspectRatio.Transform(box, viewport)
+	refX, refY := content.Transform(m.refX, m.refY)
+	transform = transform.Mult(Identity.Translate(-refX, -refY))
+
+	// the content of the marker does not inherit the style of the path,
+	// but is drawn as part of it: with its opacity, clip paths and masks
+	base := DefaultStyle
+	base.Transform = transform
+	base.Opacity = context.Opacity
+	base.Link = context.Link
+	base.ClipPaths = context.ClipPaths[:len(context.ClipPaths):len(context.ClipPaths)]
+	base.Masks = context.Masks[:len(context.Masks):len(context.Masks)]
+	if m.clip {
+		c.clipViewport(&base, viewport)
+	}
+	base.Transform = base.Transform.Mult(content)
+
+	styleStack, contextStyle, viewports, switches := c.styleStack, c.context, c.viewports, c.switches
+	c.styleStack, c.context, c.switches = []PathStyle{base}, &context, nil
+	c.viewports = append(viewports[:len(viewports):len(viewports)], box)
+	defer func() {
+		c.styleStack, c.context, c.viewports, c.switches = styleStack, contextStyle, viewports, switches
+	}()
+	if err := c.pushStyle(m.attrs); err != nil {
+		return err
+	}
+	return c.replay(m.content)
+}
@@ -66,15 +66,15 @@ func (a Matrix2D) Invert() Matrix2D {
 	return Matrix2D{A: n[0], C: n[1], E: n[2], B: n[3], D: n[4], F: n[5]}
 }
 
-// Mult returns a*b
+// Mult returns a*b, that is the transform applying b, then a.
 func (a Matrix2D) Mult(b Matrix2D) Matrix2D {
 	return Matrix2D{
 		A: a.A*b.A + a.C*b.B,
 		B: a.B*b.A + a.D*b.B,
 		C: a.A*b.C + a.C*b.D,
 		D: a.B*b.C + a.D*b.D,
-		E: a.A*b.E + a.C*b.F + a.E*b.A,
-		F: a.B*b.E + a.D*b.F + a.F*b.D,
+		E: a.A*b.E + a.C*b.F + a.E,
+		F: a.B*b.E + a.D*b.F + a.F,
 	}
 }
 
@@ -0,0 +1,335 @@
+package svg
+
+// This file implements the meshgradient element of SVG 2, a paint server
+// made of Coons patches whose corners are colored.
+
+import (
+	"encoding/xml"
+	"errors"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// MeshPoint is a point of a mesh gradient.
+type MeshPoint struct{ X, Y float64 }
+
+// MeshPatch is a Coons patch of a mesh gradient.
+type MeshPatch struct {
+	// Edges are the top, right, bottom and left edges of the patch, going
+	// around it from its top left corner. Each one is a cubic Bézier curve
+	// given by its four control points.
+	Edges [4][4]MeshPoint
+	// Colors are the colors of the top left, top right, bottom right
+	// and bottom left corners, that is at the start of each edge.
+	Colors [4]color.NRGBA
+}
+
+// MeshGradient holds a description of an SVG 2 mesh gradient, painting an
+// element with the rows of patches it is made of. Later patches are painted
+// over earlier ones, and the area outside of the patches is transparent.
+type MeshGradient struct {
+	ID      string
+	Patches [][]MeshPatch // rows of patches, sharing their edges
+	Bicubic bool          // type="bicubic", instead of bilinear color interpolation
+	Units   GradientUnits // gradientUnits
+	Matrix  Matrix2D      // gradientTransform
+}
+
+func (*MeshGradient) isPattern() {}
+
+// bezier returns the point at t of the cubic Bézier curve
+func bezier(p [4]MeshPoint, t float64) MeshPoint {
+	s := 1 - t
+	a, b, c, d := s*s*s, 3*s*s*t, 3*s*t*t, t*t*t
+	return MeshPoint{
+		X: a*p[0].X + b*p[1].X + c*p[2].X + d*p[3].X,
+		Y: a*p[0].Y + b*p[1].Y + c*p[2].Y + d*p[3].Y,
+	}
+}
+
+// Point returns the point of the patch at the parameters (u, v) in [0, 1],
+// u going from the left edge to the right one, and v from the top edge
+// to the bottom one.
+func (p *MeshPatch) Point(u, v float64) MeshPoint {
+	top, right := bezier(p.Edges[0], u), bezier(p.Edges[1], v)
+	bottom, left := bezier(p.Edges[2], 1-u), bezier(p.Edges[3], 1-v)
+	c0, c1, c2, c3 := p.Edges[0][0], p.Edges[1][0], p.Edges[2][0], p.Edges[3][0]
+	coons := func(top, right, bottom, left, c0, c1, c2, c3 float64) float64 {
+		return (1-v)*top + v*bottom + (1-u)*left + u*right -
+			((1-u)*(1-v)*c0 + u*(1-v)*c1 + u*v*c2 + (1-u)*v*c3)
+	}
+	return MeshPoint{
+		X: coons(top.X, right.X, bottom.X, left.X, c0.X, c1.X, c2.X, c3.X),
+		Y: coons(top.Y, right.Y, bottom.Y, left.Y, c0.Y, c1.Y, c2.Y, c3.Y),
+	}
+}
+
+// clampIndex returns i clamped to [0, n]
+func clampIndex(i, n int) int {
+	if i < 0 {
+		return 0
+	} else if i > n {
+		return n
+	}
+	return i
+}
+
+// cornerColor returns the color of the corner of the mesh at the
+// given row and column of corners, clamped to the mesh
+func (g *MeshGradient) cornerColor(row, col int) [4]float64 {
+	row = clampIndex(row, len(g.Patches))
+	if row == len(g.Patches) {
+		// the bottom corners of the last row
+		patches := g.Patches[row-1]
+		col = clampIndex(col, len(patches))
+		if col == len(patches) {
+			return toFloatColor(patches[col-1].Colors[2])
+		}
+		return toFloatColor(patches[col].Colors[3])
+	}
+	patches := g.Patches[row]
+	col = clampIndex(col, len(patches))
+	if col == len(patches) {
+		return toFloatColor(patches[col-1].Colors[1])
+	}
+	return toFloatColor(patches[col].Colors[0])
+}
+
+func toFloatColor(c color.NRGBA) [4]float64 {
+	return [4]float64{float64(c.R), float64(c.G), float64(c.B), float64(c.A)}
+}
+
+// Color returns the color of the patch at the given row and column, at the
+// parameters (u, v) of the patch. Bicubic interpolation is smooth across
+// patches, its derivatives being estimated from the neighboring corners.
+func (g *MeshGradient) Color(row, col int, u, v float64) color.NRGBA {
+	p := &g.Patches[row][col]
+	var out [4]float64
+	if !g.Bicubic {
+		for i, c := range p.Colors {
+			w := [4]float64{(1 - u) * (1 - v), u * (1 - v), u * v, (1 - u) * v}[i]
+			fc := toFloatColor(c)
+			for k := range out {
+				out[k] += w * fc[k]
+			}
+		}
+	} else {
+		// Hermite basis functions, for values and derivatives at 0 and 1
+		h := func(t float64) (v0, v1, d0, d1 float64) {
+			t2, t3 := t*t, t*t*t
+			return 2*t3 - 3*t2 + 1, -2*t3 + 3*t2, t3 - 2*t2 + t, t3 - t2
+		}
+		hu0, hu1, du0, du1 := h(u)
+		hv0, hv1, dv0, dv1 := h(v)
+		for j, corner := range [4]struct {
+			dr, dc int     // position of the corner in the patch
+			hu, hv float64 // weight of its value
+			du, dv float64 // weights of its derivatives
+		}{
+			{0, 0, hu0, hv0, du0, dv0},
+			{0, 1, hu1, hv0, du1, dv0},
+			{1, 1, hu1, hv1, du1, dv1},
+			{1, 0, hu0, hv1, du0, dv1},
+		} {
+			r, c := row+corner.dr, col+corner.dc
+			value := toFloatColor(p.Colors[j])
+			// derivatives by central differences, one-sided on the borders
+			left, right := g.cornerColor(r, c-1), g.cornerColor(r, c+1)
+			up, down := g.cornerColor(r-1, c), g.cornerColor(r+1, c)
+			cu, cv := 0.5, 0.5
+			if c == 0 || c == len(g.Patches[clampIndex(r, len(g.Patches)-1)]) {
+				cu = 1
+			}
+			if r == 0 || r == len(g.Patches) {
+				cv = 1
+			}
+			for k := range out {
+				out[k] += corner.hu*corner.hv*value[k] +
+					corner.du*corner.hv*cu*(right[k]-left[k]) +
+					corner.hu*corner.dv*cv*(down[k]-up[k])
+			}
+		}
+	}
+	clamp := func(f float64) uint8 { return uint8(math.Round(math.Max(0, math.Min(255, f)))) }
+	return color.NRGBA{R: clamp(out[0]), G: clamp(out[1]), B: clamp(out[2]), A: clamp(out[3])}
+}
+
+// meshCursor is the state of the mesh gradient being parsed
+type meshCursor struct {
+	mesh  *MeshGradient
+	x, y  float64 // top left corner of the first patch
+	stops []meshStop
+}
+
+// meshStop is a stop of a mesh patch, giving
+// an edge and the color of its first corner
+type meshStop struct {
+	path  string
+	color color.NRGBA
+}
+
+func meshGradientF(c *svgCursor, attrs []xml.Attr) error {
+	mc := &meshCursor{mesh: &MeshGradient{Matrix: Identity}}
+	var err error
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "id":
+			mc.mesh.ID = attr.Value
+		case "x":
+			mc.x, err = c.parseUnit(attr.Value, widthPercentage)
+		case "y":
+			mc.y, err = c.parseUnit(attr.Value, heightPercentage)
+		case "type":
+			mc.mesh.Bicubic = attr.Value == "bicubic"
+		case "gradientUnits":
+			if strings.TrimSpace(attr.Value) == "objectBoundingBox" {
+				mc.mesh.Units = ObjectBoundingBox
+			} else {
+				mc.mesh.Units = UserSpaceOnUse
+			}
+		case "gradientTransform":
+			mc.mesh.Matrix, err = c.parseTransformFrom(Identity, attr.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if mc.mesh.ID != "" {
+		c.svg.meshes[mc.mesh.ID] = mc.mesh
+	}
+	c.mesh = mc
+	return nil
+}
+
+func meshRowF(c *svgCursor, attrs []xml.Attr) error {
+	if c.mesh != nil {
+		c.mesh.mesh.Patches = append(c.mesh.mesh.Patches, nil)
+	}
+	return nil
+}
+
+func meshPatchF(c *svgCursor, attrs []xml.Attr) error {
+	if c.mesh != nil {
+		c.mesh.stops = c.mesh.stops[:0]
+	}
+	return nil
+}
+
+// addMeshStop adds a stop to the patch being parsed
+func (c *svgCursor) addMeshStop(attrs []xml.Attr, stop GradStop) {
+	if stop.StopColor == nil {
+		stop.StopColor = color.Black // initial value of stop-color
+	}
+	opacity := math.Max(0, math.Min(1, stop.Opacity))
+	r, g, b, a := stop.StopColor.RGBA()
+	s := meshStop{color: color.NRGBAModel.Convert(color.RGBA64{
+		R: uint16(float64(r) * opacity), G: uint16(float64(g) * opacity),
+		B: uint16(float64(b) * opacity), A: uint16(float64(a) * opacity),
+	}).(color.NRGBA)}
+	for _, attr := range attrs {
+		if attr.Name.Local == "path" {
+			s.path = attr.Value
+		}
+	}
+	c.mesh.stops = append(c.mesh.stops, s)
+}
+
+// endMeshPatch adds the patch which just ended to the current row. The
+// edges shared with the patches above and on the left are not repeated.
+func (c *svgCursor) endMeshPatch() error {
+	mc := c.mesh
+	if mc == nil || len(mc.mesh.Patches) == 0 {
+		return nil
+	}
+	row, col := len(mc.mesh.Patches)-1, len(mc.mesh.Patches[len(mc.mesh.Patches)-1])
+	var (
+		patch MeshPatch
+		known [4]bool // edges and corner colors given by the other patches
+	)
+	reverse := func(e [4]MeshPoint) [4]MeshPoint { return [4]MeshPoint{e[3], e[2], e[1], e[0]} }
+	start := MeshPoint{X: mc.x, Y: mc.y}
+	if row > 0 {
+		if col >= len(mc.mesh.Patches[row-1]) {
+			return c.handleError("mesh patch without patch above")
+		}
+		above := &mc.mesh.Patches[row-1][col]
+		patch.Edges[0] = reverse(above.Edges[2])
+		patch.Colors[0], patch.Colors[1] = above.Colors[3], above.Colors[2]
+		known[0], known[1] = true, true
+		start = patch.Edges[0][0]
+	}
+	if col > 0 {
+		left := &mc.mesh.Patches[row][col-1]
+		patch.Edges[3] = reverse(left.Edges[1])
+		patch.Colors[0], patch.Colors[3] = left.Colors[1], left.Colors[2]
+		known[0], known[3] = true, true
+		start = left.Edges[1][0]
+	}
+	// the stops give the remaining edges, in order
+	current, stops := start, mc.stops
+	for edge := 0; edge < 4; edge++ {
+		if (edge == 0 && row > 0) || (edge == 3 && col > 0) {
+			current = patch.Edges[edge][3]
+			continue
+		}
+		if len(stops) == 0 {
+			return c.handleError("missing stops in mesh patch")
+		}
+		s := stops[0]
+		stops = stops[1:]
+		if !known[edge] { // the colors of shared corners are ignored
+			patch.Colors[edge] = s.color
+		}
+		if edge == 3 && strings.TrimSpace(s.path) == "" {
+			// the path closing the patch may be omitted
+			patch.Edges[3] = lineEdge(current, start)
+			break
+		}
+		var err error
+		if patch.Edges[edge], err = c.parseMeshEdge(s.path, current); err != nil {
+			return err
+		}
+		current = patch.Edges[edge][3]
+	}
+	mc.mesh.Patches[row] = append(mc.mesh.Patches[row], patch)
+	return nil
+}
+
+// lineEdge returns the straight edge from p to q, as a cubic curve
+func lineEdge(p, q MeshPoint) [4]MeshPoint {
+	return [4]MeshPoint{
+		p,
+		{X: p.X + (q.X-p.X)/3, Y: p.Y + (q.Y-p.Y)/3},
+		{X: p.X + 2*(q.X-p.X)/3, Y: p.Y + 2*(q.Y-p.Y)/3},
+		q,
+	}
+}
+
+// parseMeshEdge parses the path of a mesh stop, made of a single line
+// or cubic curve command, starting at the current point.
+func (c *svgCursor) parseMeshEdge(path string, current MeshPoint) ([4]MeshPoint, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return [4]MeshPoint{}, errors.New("missing path in mesh stop")
+	}
+	cmd := path[0]
+	if err := c.getPoints(path[1:]); err != nil {
+		return [4]MeshPoint{}, err
+	}
+	var points []MeshPoint
+	for i := 0; i+1 < len(c.points); i += 2 {
+		p := MeshPoint{X: c.points[i], Y: c.points[i+1]}
+		if cmd == 'l' || cmd == 'c' {
+			p.X, p.Y = p.X+current.X, p.Y+current.Y
+		}
+		points = append(points, p)
+	}
+	switch {
+	case (cmd == 'l' || cmd == 'L') && len(points) == 1:
+		return lineEdge(current, points[0]), nil
+	case (cmd == 'c' || cmd == 'C') && len(points) == 3:
+		return [4]MeshPoint{current, points[0], points[1], points[2]}, nil
+	}
+	return [4]MeshPoint{}, errParamMismatch
+}
@@ -0,0 +1,108 @@
+package svg
+
+// parseOptions holds the optional settings of the parser
+type parseOptions struct {
+	fonts        FontProvider
+	resolver     Resolver
+	resolveDepth int
+	languages    []string             // preferred languages, for systemLanguage attributes
+	namespaces   map[string]ErrorMode // handling of unsupported elements, by namespace
+	name         string               // name of the document, against which references are resolved
+	res          *resolution          // shared with the referencing document
+}
+
+// ParseOption is a interface for parser options.
+type ParseOption interface {
+	apply(o *parseOptions)
+}
+
+type fontsOption struct {
+	provider FontProvider
+}
+
+func (f fontsOption) apply(o *parseOptions) {
+	o.fonts = f.provider
+}
+
+// Fonts specifies the provider of the fonts used to render text elements.
+// Without it, text elements are not drawn.
+func Fonts(p FontProvider) ParseOption {
+	return fontsOption{provider: p}
+}
+
+type resourcesOption struct {
+	resolver Resolver
+}
+
+func (r resourcesOption) apply(o *parseOptions) {
+	o.resolver = r.resolver
+}
+
+// Resources specifies the resolver of the references to other documents and
+// images. Without it, only the elements of the parsed document are referenced,
+// and images must be embedded with data URIs. As references are read from the
+// document, the resolver should only give access to trusted resources.
+func Resources(r Resolver) ParseOption {
+	return resourcesOption{resolver: r}
+}
+
+type resolveDepthOption int
+
+func (d resolveDepthOption) apply(o *parseOptions) {
+	o.resolveDepth = int(d)
+}
+
+// ResolveDepth limits the number of nested references to other documents,
+// such as use elements referencing elements of other documents, which
+// reference other documents in turn. The default is DefaultResolveDepth.
+// References within a document are not limited, besides being checked for
+// cycles, and neither is the number of references of a document.
+func ResolveDepth(depth int) ParseOption {
+	return resolveDepthOption(depth)
+}
+
+type languagesOption []string
+
+func (l languagesOption) apply(o *parseOptions) {
+	o.languages = l
+}
+
+// Languages specifies the preferred languages of the user, as BCP 47
+// tags such as "de" or "en-US", used to evaluate the systemLanguage
+// attributes of conditional elements. Without it, these attributes
+// evaluate to false.
+func Languages(tags ...string) ParseOption {
+	return languagesOption(tags)
+}
+
+type namespaceOption struct {
+	uri  string
+	mode ErrorMode
+}
+
+func (n namespaceOption) apply(o *parseOptions) {
+	namespaces := make(map[string]ErrorMode, len(o.namespaces)+1)
+	for uri, mode := range o.namespaces {
+		namespaces[uri] = mode
+	}
+	namespaces[n.uri] = n.mode
+	o.namespaces = namespaces
+}
+
+// Namespace specifies how the elements of the namespace given by its URI are
+// handled: as they are not supported, they are skipped with their descendants,
+// and mode tells whether they are reported. Elements of other namespaces than
+// SvgNamespace are ignored by default, while unsupported SVG elements are
+// reported according to the error mode of the parser.
+func Namespace(uri string, mode ErrorMode) ParseOption {
+	return namespaceOption{uri: uri, mode: mode}
+}
+
+// newParseOptions returns the options with the given defaults
+func newParseOptions(defaults parseOptions, opts []ParseOption) parseOptions {
+	defaults.resolveDepth = DefaultResolveDepth
+	for _, opt := range opts {
+		opt.apply(&defaults)
+	}
+	return defaults
+}
@@ -8,6 +8,7 @@ import (
 	"math"
 	"strings"
 
+	"golang.org/x/image/font/sfnt"
 	"golang.org/x/image/math/fixed"
 )
 
@@ -15,18 +16,27 @@ type (
 	// svgCursor is used while parsing SVG files
 	svgCursor struct {
 		pathCursor
-		svg                                             *Svg
-		styleStack                                      []PathStyle
-		grad                                            *Gradient
-		inTitleText, inDescText, inGrad, inDefs, inMask bool
-		currentDef                                      []definition
-		mask                                            *SvgMask
-	}
-
-	// definition is used to store what's given in a def tag
-	definition struct {
-		ID, Tag string
-		Attrs   []xml.Attr
+		svg                                              *Svg
+		styleStack                                       []PathStyle
+		grad                                             *Gradient
+		inTitleText, inDescText, inGrad, inMask, inStyle bool
+		hidden                                           int        // depth in defs and symbols, only drawn by use elements
+		viewports                                        []Bounds   // view boxes of the open svg elements
+		context                                          *PathStyle // style of the path whose marker is drawn
+		switches                                         []switchFrame
+		skipped                                          int // depth in an element which is not drawn
+		mask                                             *SvgMask
+		clip                                             *SvgClipPath
+		pattern                                          *TilePattern
+		mesh                                             *meshCursor
+		text                                             *textCursor
+		fonts                                            FontProvider
+		embeddedFonts                                    *FontCollection // fonts of @font-face rules
+		fontCache                                        map[fontKey]*sfnt.Font
+		styleText                                        strings.Builder // content of the style element
+		options                                          parseOptions
+		name, base                                       string // names of the document, and of the one references are relative to
+		res                                              *resolution
 	}
 )
 
@@ -53,14 +63,14 @@ func (c *svgCursor) readTransformAttr(m1 Matrix2D, k string) (Matrix2D, error) {
 			m1 = m1.Rotate(c.points[0] * math.Pi / 180)
 		} else if ln == 3 {
 			m1 = m1.Translate(c.points[1], c.points[2]).
-				Rotate(c.points[0]*math.Pi/180).
-				Translate(-c.points[1], -c.points[2])
+				Rotate(c.points[0] * math.Pi / 180).
+				Mult(Identity.Translate(-c.points[1], -c.points[2]))
 		} else {
 			return m1, errParamMismatch
 		}
 	case "translate":
 		if ln == 1 {
-			m1 = m1.Translate(c.points[0], c.points[0])
+			m1 = m1.Translate(c.points[0], 0)
 		} else if ln == 2 {
 			m1 = m1.Translate(c.points[0], c.points[1])
 		} else {
@@ -106,12 +116,17 @@ func (c *svgCursor) readTransformAttr(m1 Matrix2D, k string) (Matrix2D, error) {
 }
 
 func (c *svgCursor) parseTransform(v string) (Matrix2D, error) {
+	return c.parseTransformFrom(c.styleStack[len(c.styleStack)-1].Transform, v)
+}
+
+// parseTransformFrom applies the transform list v to the matrix m1
+func (c *svgCursor) parseTransformFrom(m1 Matrix2D, v string) (Matrix2D, error) {
 	ts := strings.Split(v, ")")
-	m1 := c.styleStack[len(c.styleStack)-1].Transform
 	// From the docs at https://devdoc.net/web/developer.mozilla.org/en-US/docs/Web/SVG/Attribute/transform.html:
 	// The items in the transform list are separated by whitespace and/or commas, and are applied from right to left.
-	for i := len(ts) - 1; i >= 0; i-- {
-		t := strings.TrimSpace(ts[i])
+	// Each item is thus multiplied on the right of the previous ones.
+	for _, t := range ts {
+		t = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(t), ","))
 		if len(t) == 0 {
 			continue
 		}
@@ -123,10 +138,11 @@ func (c *svgCursor) parseTransform(v string) (Matrix2D, error) {
 		if err != nil {
 			return m1, err
 		}
-		m1, err = c.readTransformAttr(m1, strings.ToLower(strings.TrimSpace(d[0])))
+		m, err := c.readTransformAttr(Identity, strings.ToLower(strings.TrimSpace(d[0])))
 		if err != nil {
 			return m1, err
 		}
+		m1 = m1.Mult(m)
 	}
 	return m1, nil
 }
@@ -149,12 +165,55 @@ func (c *svgCursor) parseSelector(v string) (string, error) {
 	return "", fmt.Errorf("unsupported selector: %s", v)
 }
 
+// contextPaint returns the paint of the path whose marker is being drawn,
+// for the context-fill and context-stroke values. It returns false for
+// other values.
+func (c *svgCursor) contextPaint(v string) (Pattern, bool) {
+	switch v {
+	case "context-fill":
+		if c.context == nil {
+			return nil, true
+		}
+		return c.context.FillerColor, true
+	case "context-stroke":
+		if c.context == nil {
+			return nil, true
+		}
+		return c.context.LinerColor, true
+	}
+	return nil, false
+}
+
 func (c *svgCursor) readStyleAttr(curStyle *PathStyle, k, v string) error {
 	switch k {
+	case "display":
+		if v == "inherit" {
+			// not inherited otherwise
+			curStyle.displayNone = c.styleStack[len(c.styleStack)-1].displayNone
+		} else {
+			curStyle.displayNone = v == "none"
+		}
+	case "visibility":
+		if v != "inherit" {
+			curStyle.invisible = v == "hidden" || v == "collapse"
+		}
+	case "paint-order":
+		order, ok := parsePaintOrder(v)
+		if !ok {
+			return c.handleError("unsupported value '%s' for <paint-order>", v)
+		}
+		curStyle.PaintOrder = order
 	case "fill":
-		gradient, ok := c.readGradURL(v, curStyle.FillerColor)
+		if paint, ok := c.contextPaint(v); ok {
+			curStyle.FillerColor = paint
+			break
+		}
+		paint, ok, err := c.readPaintURL(v, curStyle.FillerColor)
+		if err != nil {
+			return err
+		}
 		if ok {
-			curStyle.FillerColor = gradient
+			curStyle.FillerColor = paint
 			break
 		}
 		optCol, err := parseSVGColor(v)
@@ -170,9 +229,16 @@ func (c *svgCursor) readStyleAttr(curStyle *PathStyle, k, v string) error {
 			return c.handleError("unsupported value '%s' for <fill-rule>", v)
 		}
 	case "stroke":
-		gradient, ok := c.readGradURL(v, curStyle.LinerColor)
+		if paint, ok := c.contextPaint(v); ok {
+			curStyle.LinerColor = paint
+			break
+		}
+		paint, ok, err := c.readPaintURL(v, curStyle.LinerColor)
+		if err != nil {
+			return err
+		}
 		if ok {
-			curStyle.LinerColor = gradient
+			curStyle.LinerColor = paint
 			break
 		}
 		optCol, errc := parseSVGColor(v)
@@ -252,6 +318,15 @@ func (c *svgCursor) readStyleAttr(curStyle *PathStyle, k, v string) error {
 			return err
 		}
 		curStyle.LineWidth = width
+	case "vector-effect":
+		switch v {
+		case "none":
+			curStyle.NonScalingStroke = false
+		case "non-scaling-stroke":
+			curStyle.NonScalingStroke = true
+		default:
+			return c.handleError("unsupported value '%s' for <vector-effect>", v)
+		}
 	case "stroke-dashoffset":
 		dashOffset, err := c.parseUnit(v, diagPercentage)
 		if err != nil {
@@ -277,6 +352,9 @@ func (c *svgCursor) readStyleAttr(curStyle *PathStyle, k, v string) error {
 		if err != nil {
 			return err
 		}
+		if k == "opacity" {
+			curStyle.Opacity *= op
+		}
 		if k != "stroke-opacity" {
 			curStyle.FillOpacity *= op
 		}
@@ -295,6 +373,96 @@ func (c *svgCursor) readStyleAttr(curStyle *PathStyle, k, v string) error {
 			return err
 		}
 		curStyle.Masks = append(curStyle.Masks, id)
+	case "clip-path":
+		id, err := c.parseSelector(v)
+		if err != nil {
+			// such as basic shapes, or references to other documents
+			return c.handleError("unsupported value '%s' for <clip-path>: %s", v, err)
+		}
+		if id != "" {
+			// the slice is copied, as it is shared with the parent style
+			n := len(curStyle.ClipPaths)
+			curStyle.ClipPaths = append(curStyle.ClipPaths[:n:n], &ClipRef{ID: id})
+		}
+	case "marker", "marker-start", "marker-mid", "marker-end":
+		id, err := c.parseSelector(v)
+		if err != nil {
+			return err
+		}
+		if k != "marker-mid" && k != "marker-end" {
+			curStyle.MarkerStart = id
+		}
+		if k != "marker-start" && k != "marker-end" {
+			curStyle.MarkerMid = id
+		}
+		if k != "marker-start" && k != "marker-mid" {
+			curStyle.MarkerEnd = id
+		}
+	case "clip-rule":
+		switch v {
+		case "evenodd":
+			curStyle.ClipNonZeroWinding = false
+		case "nonzero":
+			curStyle.ClipNonZeroWinding = true
+		default:
+			return c.handleError("unsupported value '%s' for <clip-rule>", v)
+		}
+	case "font-family":
+		curStyle.Font.Family = v
+	case "font-size":
+		size, err := c.parseFontSize(v, curStyle.Font.Size)
+		if err != nil {
+			return err
+		}
+		curStyle.Font.Size = size
+	case "font-weight":
+		weight, err := parseFontWeight(v, curStyle.Font.Weight)
+		if err != nil {
+			return c.handleError("unsupported value '%s' for <font-weight>", v)
+		}
+		curStyle.Font.Weight = weight
+	case "font-style":
+		switch v {
+		case "normal":
+			curStyle.Font.Style = FontStyleNormal
+		case "italic":
+			curStyle.Font.Style = FontStyleItalic
+		case "oblique":
+			curStyle.Font.Style = FontStyleOblique
+		default:
+			return c.handleError("unsupported value '%s' for <font-style>", v)
+		}
+	case "text-anchor":
+		switch v {
+		case "start":
+			curStyle.Text.Anchor = TextAnchorStart
+		case "middle":
+			curStyle.Text.Anchor = TextAnchorMiddle
+		case "end":
+			curStyle.Text.Anchor = TextAnchorEnd
+		default:
+			return c.handleError("unsupported value '%s' for <text-anchor>", v)
+		}
+	case "dominant-baseline", "alignment-baseline":
+		baseline, ok := baselines[v]
+		if !ok {
+			return c.handleError("unsupported value '%s' for <%s>", v, k)
+		}
+		if k == "dominant-baseline" {
+			curStyle.Text.DominantBaseline = baseline
+		} else {
+			curStyle.Text.AlignmentBaseline = baseline
+		}
+	case "letter-spacing", "word-spacing":
+		spacing, err := c.parseSpacing(v, curStyle.Font.Size)
+		if err != nil {
+			return err
+		}
+		if k == "letter-spacing" {
+			curStyle.Text.LetterSpacing = spacing
+		} else {
+			curStyle.Text.WordSpacing = spacing
+		}
 	}
 	return nil
 }
@@ -314,6 +482,10 @@ func (c *svgCursor) pushStyle(attrs []xml.Attr) error {
 	}
 	// Make a copy of the top style
 	curStyle := c.styleStack[len(c.styleStack)-1]
+	curStyle.Text.AlignmentBaseline = BaselineAuto // not inherited
+	curStyle.displayNone = false
+	curStyle.NonScalingStroke = false
+	inheritedClips := len(curStyle.ClipPaths)
 	for _, pair := range pairs {
 		kv := strings.Split(pair, ":")
 		if len(kv) >= 2 {
@@ -326,6 +498,11 @@ func (c *svgCursor) pushStyle(attrs []xml.Attr) error {
 			}
 		}
 	}
+	// a clip path applies in the user space of the element,
+	// which includes its own transform
+	for _, ref := range curStyle.ClipPaths[inheritedClips:] {
+		ref.Transform = curStyle.Transform
+	}
 	c.styleStack = append(c.styleStack, curStyle) // Push style onto stack
 	return nil
 }
@@ -338,52 +515,135 @@ func splitOnCommaOrSpace(s string) []string {
 		})
 }
 
+// isHidden returns true if the element with the given
+// name is in defs, a symbol or a marker, and is not read
+func (c *svgCursor) isHidden(name string) bool {
+	if c.hidden == 0 || c.inGrad || c.mesh != nil || c.clip != nil || c.pattern != nil {
+		return false
+	}
+	// paint servers, stylesheets, clip paths and views are read even inside
+	// defs, as well as nested defs, symbols and markers to keep track of
+	// their depth
+	switch name {
+	case "radialGradient", "linearGradient", "meshgradient", "pattern", "style", "clipPath", "defs", "symbol", "marker", "view":
+		return false
+	}
+	return true
+}
+
 func (c *svgCursor) readStartElement(se xml.StartElement) (err error) {
-	var skipDef bool
-	if se.Name.Local == "radialGradient" || se.Name.Local == "linearGradient" || c.inGrad {
-		skipDef = true
+	if c.isHidden(se.Name.Local) {
+		return nil
 	}
-	if c.inDefs && !skipDef {
-		ID := ""
-		for _, attr := range se.Attr {
-			if attr.Name.Local == "id" {
-				ID = attr.Value
+	err = drawFuncs[se.Name.Local](c, se.Attr)
+
+	if len(c.path) > 0 {
+		// The svgCursor parsed a path from the xml element
+		pathCopy := append(Path{}, c.path...)
+		style := c.styleStack[len(c.styleStack)-1]
+		c.path = c.path[:0]
+		switch se.Name.Local {
+		case "path", "line", "polyline", "polygon":
+			if err == nil && c.clip == nil && !style.invisible {
+				return c.paintShape(pathCopy, style)
 			}
 		}
-		if ID != "" && len(c.currentDef) > 0 {
-			c.svg.defs[c.currentDef[0].ID] = c.currentDef
-			c.currentDef = make([]definition, 0)
+		c.appendPath(pathCopy, style)
+	}
+	return
+}
+
+// paintShape stores the path and places its markers, in the paint order
+// of the style. The fill and the stroke are stored as separate paths when
+// the markers are painted between them, and only the first one is linked,
+// so that the element has a single link region.
+func (c *svgCursor) paintShape(path Path, style PathStyle) error {
+	layers := style.PaintOrder.Layers()
+	shape := style
+	for i := 0; i < len(layers); i++ {
+		if layers[i] == PaintMarkers {
+			if err := c.placeMarkers(path, style); err != nil {
+				return err
+			}
+			continue
 		}
-		c.currentDef = append(c.currentDef, definition{
-			ID:    ID,
-			Tag:   se.Name.Local,
-			Attrs: se.Attr,
-		})
-		return nil
+		if i+1 < len(layers) && layers[i+1] != PaintMarkers {
+			// the renderers paint the fill and the stroke in order
+			c.appendPath(path, shape)
+			i++
+			continue
+		}
+		part := shape
+		if layers[i] == PaintFill {
+			part.LinerColor = nil
+		} else {
+			part.FillerColor = nil
+		}
+		c.appendPath(path, part)
+		shape.Link = nil
+	}
+	return nil
+}
+
+// isUnsupported returns true if the element is not supported, either
+// because it is unknown or because it belongs to an other namespace than
+// SVG, after handling the error given by the policy of its namespace.
+// Its descendants are then skipped as well.
+func (c *svgCursor) isUnsupported(se xml.StartElement) (bool, error) {
+	ns := se.Name.Space
+	if ns == "" {
+		ns = SvgNamespace
+	}
+	if _, ok := drawFuncs[se.Name.Local]; ok && ns == SvgNamespace {
+		return false, nil
+	}
+	if animationElements[se.Name.Local] && ns == SvgNamespace {
+		// read by readAnimations
+		return true, nil
 	}
-	df, ok := drawFuncs[se.Name.Local]
+	if c.isHidden(se.Name.Local) {
+		// not drawn anyway
+		return true, nil
+	}
+	mode, ok := c.options.namespaces[ns]
 	if !ok {
-		errStr := "Cannot process svg element " + se.Name.Local
-		if c.errorMode == StrictErrorMode {
-			return errors.New(errStr)
-		} else if c.errorMode == WarnErrorMode {
-			log.Println(errStr)
+		mode = IgnoreErrorMode
+		if ns == SvgNamespace {
+			mode = c.errorMode
 		}
-		return nil
 	}
-	err = df(c, se.Attr)
+	errStr := "Cannot process svg element " + se.Name.Local
+	if ns != SvgNamespace {
+		errStr = "Cannot process element " + se.Name.Local + " of namespace " + ns
+	}
+	if mode == StrictErrorMode {
+		return true, errors.New(errStr)
+	} else if mode == WarnErrorMode {
+		log.Println(errStr)
+	}
+	return true, nil
+}
 
-	if len(c.path) > 0 {
-		// The svgCursor parsed a path from the xml element
-		pathCopy := append(Path{}, c.path...)
-		if c.inMask && c.mask != nil {
-			c.mask.SvgPaths = append(c.mask.SvgPaths,
-				SvgPath{Path: pathCopy, Style: c.styleStack[len(c.styleStack)-1]})
-		} else if !c.inMask {
-			c.svg.SvgPaths = append(c.svg.SvgPaths,
-				SvgPath{Path: pathCopy, Style: c.styleStack[len(c.styleStack)-1]})
+// appendPath stores the path with the given style, either
+// in the clip path or mask being parsed or in the drawing order.
+// Invisible paths are only part of the bounds of their clip paths.
+func (c *svgCursor) appendPath(path Path, style PathStyle) {
+	for _, ref := range style.ClipPaths {
+		// the bounding box of a path does not include its markers
+		if c.context == nil || !containsClipRef(c.context.ClipPaths, ref) {
+			ref.extend(path, style.Transform)
 		}
-		c.path = c.path[:0]
 	}
-	return
+	if style.invisible {
+		return
+	}
+	if c.clip != nil {
+		c.clip.SvgPaths = append(c.clip.SvgPaths, SvgPath{Path: path, Style: style})
+	} else if c.pattern != nil {
+		c.pattern.SvgPaths = append(c.pattern.SvgPaths, SvgPath{Path: path, Style: style})
+	} else if c.inMask && c.mask != nil {
+		c.mask.SvgPaths = append(c.mask.SvgPaths, SvgPath{Path: path, Style: style})
+	} else if !c.inMask {
+		c.svg.SvgPaths = append(c.svg.SvgPaths, SvgPath{Path: path, Style: style})
+	}
 }
@@ -33,7 +33,6 @@ var (
 type pathCursor struct {
 	path                   Path
 	placeX, placeY         float64
-	curX, curY             float64
 	cntlPtX, cntlPtY       float64
 	pathStartX, pathStartY float64
 	points                 []float64
@@ -215,11 +214,11 @@ func (c *pathCursor) addSeg(segString string) error {
 		}
 		c.pathStartX, c.pathStartY = c.points[0], c.points[1]
 		c.inPath = true
-		c.path.Start(fixed.Point26_6{X: fixed.Int26_6((c.pathStartX + c.curX) * 64), Y: fixed.Int26_6((c.pathStartY + c.curY) * 64)})
+		c.path.Start(fixed.Point26_6{X: fixed.Int26_6(c.pathStartX * 64), Y: fixed.Int26_6(c.pathStartY * 64)})
 		for i := 2; i < l-1; i += 2 {
 			c.path.Line(fixed.Point26_6{
-				X: fixed.Int26_6((c.points[i] + c.curX) * 64),
-				Y: fixed.Int26_6((c.points[i+1] + c.curY) * 64),
+				X: fixed.Int26_6(c.points[i] * 64),
+				Y: fixed.Int26_6(c.points[i+1] * 64),
 			})
 		}
 		c.placeX = c.points[l-2]
@@ -233,8 +232,8 @@ func (c *pathCursor) addSeg(segString string) error {
 		}
 		for i := 0; i < l-1; i += 2 {
 			c.path.Line(fixed.Point26_6{
-				X: fixed.Int26_6((c.points[i] + c.curX) * 64),
-				Y: fixed.Int26_6((c.points[i+1] + c.curY) * 64),
+				X: fixed.Int26_6(c.points[i] * 64),
+				Y: fixed.Int26_6(c.points[i+1] * 64),
 			})
 		}
 		c.placeX = c.points[l-2]
@@ -248,8 +247,8 @@ func (c *pathCursor) addSeg(segString string) error {
 		}
 		for _, p := range c.points {
 			c.path.Line(fixed.Point26_6{
-				X: fixed.Int26_6((c.placeX + c.curX) * 64),
-				Y: fixed.Int26_6((p + c.curY) * 64),
+				X: fixed.Int26_6(c.placeX * 64),
+				Y: fixed.Int26_6(p * 64),
 			})
 		}
 		c.placeY = c.points[l-1]
@@ -262,8 +261,8 @@ func (c *pathCursor) addSeg(segString string) error {
 		}
 		for _, p := range c.points {
 			c.path.Line(fixed.Point26_6{
-				X: fixed.Int26_6((p + c.curX) * 64),
-				Y: fixed.Int26_6((c.placeY + c.curY) * 64),
+				X: fixed.Int26_6(p * 64),
+				Y: fixed.Int26_6(c.placeY * 64),
 			})
 		}
 		c.placeX = c.points[l-1]
@@ -277,12 +276,12 @@ func (c *pathCursor) addSeg(segString string) error {
 		for i := 0; i < l-3; i += 4 {
 			c.path.QuadBezier(
 				fixed.Point26_6{
-					X: fixed.Int26_6((c.points[i] + c.curX) * 64),
-					Y: fixed.Int26_6((c.points[i+1] + c.curY) * 64),
+					X: fixed.Int26_6(c.points[i] * 64),
+					Y: fixed.Int26_6(c.points[i+1] * 64),
 				},
 				fixed.Point26_6{
-					X: fixed.Int26_6((c.points[i+2] + c.curX) * 64),
-					Y: fixed.Int26_6((c.points[i+3] + c.curY) * 64),
+					X: fixed.Int26_6(c.points[i+2] * 64),
+					Y: fixed.Int26_6(c.points[i+3] * 64),
 				})
 		}
 		c.cntlPtX, c.cntlPtY = c.points[l-4], c.points[l-3]
@@ -299,12 +298,12 @@ func (c *pathCursor) addSeg(segString string) error {
 			c.reflectControlQuad()
 			c.path.QuadBezier(
 				fixed.Point26_6{
-					X: fixed.Int26_6((c.cntlPtX + c.curX) * 64),
-					Y: fixed.Int26_6((c.cntlPtY + c.curY) * 64),
+					X: fixed.Int26_6(c.cntlPtX * 64),
+					Y: fixed.Int26_6(c.cntlPtY * 64),
 				},
 				fixed.Point26_6{
-					X: fixed.Int26_6((c.points[i] + c.curX) * 64),
-					Y: fixed.Int26_6((c.points[i+1] + c.curY) * 64),
+					X: fixed.Int26_6(c.points[i] * 64),
+					Y: fixed.Int26_6(c.points[i+1] * 64),
 				})
 			c.lastKey = k
 			c.placeX = c.points[i]
@@ -320,16 +319,16 @@ func (c *pathCursor) addSeg(segString string) error {
 		for i := 0; i < l-5; i += 6 {
 			c.path.CubeBezier(
 				fixed.Point26_6{
-					X: fixed.Int26_6((c.points[i] + c.curX) * 64),
-					Y: fixed.Int26_6((c.points[i+1] + c.curY) * 64),
+					X: fixed.Int26_6(c.points[i] * 64),
+					Y: fixed.Int26_6(c.points[i+1] * 64),
 				},
 				fixed.Point26_6{
-					X: fixed.Int26_6((c.points[i+2] + c.curX) * 64),
-					Y: fixed.Int26_6((c.points[i+3] + c.curY) * 64),
+					X: fixed.Int26_6(c.points[i+2] * 64),
+					Y: fixed.Int26_6(c.points[i+3] * 64),
 				},
 				fixed.Point26_6{
-					X: fixed.Int26_6((c.points[i+4] + c.curX) * 64),
-					Y: fixed.Int26_6((c.points[i+5] + c.curY) * 64),
+					X: fixed.Int26_6(c.points[i+4] * 64),
+					Y: fixed.Int26_6(c.points[i+5] * 64),
 				})
 		}
 		c.cntlPtX, c.cntlPtY = c.points[l-4], c.points[l-3]
@@ -345,13 +344,13 @@ func (c *pathCursor) addSeg(segString string) error {
 		for i := 0; i < l-3; i += 4 {
 			c.reflectControlCube()
 			c.path.CubeBezier(fixed.Point26_6{
-				X: fixed.Int26_6((c.cntlPtX + c.curX) * 64), Y: fixed.Int26_6((c.cntlPtY + c.curY) * 64),
+				X: fixed.Int26_6(c.cntlPtX * 64), Y: fixed.Int26_6(c.cntlPtY * 64),
 			},
 				fixed.Point26_6{
-					X: fixed.Int26_6((c.points[i] + c.curX) * 64), Y: fixed.Int26_6((c.points[i+1] + c.curY) * 64),
+					X: fixed.Int26_6(c.points[i] * 64), Y: fixed.Int26_6(c.points[i+1] * 64),
 				},
 				fixed.Point26_6{
-					X: fixed.Int26_6((c.points[i+2] + c.curX) * 64), Y: fixed.Int26_6((c.points[i+3] + c.curY) * 64),
+					X: fixed.Int26_6(c.points[i+2] * 64), Y: fixed.Int26_6(c.points[i+3] * 64),
 				})
 			c.lastKey = k
 			c.cntlPtX, c.cntlPtY = c.points[i], c.points[i+1]
@@ -386,13 +385,16 @@ func (c *pathCursor) addSeg(segString string) error {
 // to the pathCursor
 func (c *pathCursor) ellipseAt(cx, cy, rx, ry float64) {
 	c.placeX, c.placeY = cx+rx, cy
-	c.points = c.points[0:0]
-	c.points = append(c.points, rx, ry, 0.0, 1.0, 0.0, c.placeX, c.placeY)
 	c.path.Start(fixed.Point26_6{
 		X: fixed.Int26_6(c.placeX * 64),
 		Y: fixed.Int26_6(c.placeY * 64),
 	})
-	c.placeX, c.placeY = c.path.addArc(c.points, cx, cy, c.placeX, c.placeY)
+	// the outline starts at the rightmost point and goes in the positive
+	// angle direction, as two half ellipses
+	for _, x := range [2]float64{cx - rx, cx + rx} {
+		c.points = append(c.points[0:0], rx, ry, 0.0, 0.0, 1.0, x, cy)
+		c.placeX, c.placeY = c.path.addArc(c.points, cx, cy, c.placeX, c.placeY)
+	}
 	c.path.Stop(true)
 }
 
@@ -400,5 +402,5 @@ func (c *pathCursor) ellipseAt(cx, cy, rx, ry float64) {
 func (c *pathCursor) addArcFromA(points []float64) {
 	cx, cy := findEllipseCenter(&points[0], &points[1], points[2]*math.Pi/180, c.placeX,
 		c.placeY, points[5], points[6], points[4] == 0, points[3] == 0)
-	c.placeX, c.placeY = c.path.addArc(c.points, cx+c.curX, cy+c.curY, c.placeX+c.curX, c.placeY+c.curY)
+	c.placeX, c.placeY = c.path.addArc(c.points, cx, cy, c.placeX, c.placeY)
 }
@@ -1,8 +1,13 @@
 package svg
 
 import (
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"math"
 	"strings"
 	"testing"
+	"time"
 )
 
 func parseSvg(t *testing.T, svgPath string) *Svg {
@@ -64,3 +69,930 @@ func TestMask(t *testing.T) {
 		t.Fatal("expected to have 4 masks")
 	}
 }
+
+func TestClipPath(t *testing.T) {
+	s := parseSvg(t, "testdata/clipPath.svg")
+	if len(s.ClipPaths) != 5 {
+		t.Fatalf("expected 5 clip paths, got %d", len(s.ClipPaths))
+	}
+	if s.ClipPaths["bbox"].Units != ObjectBoundingBox || s.ClipPaths["circle"].Units != UserSpaceOnUse {
+		t.Error("unexpected clip path units")
+	}
+	if s.ClipPaths["star"].SvgPaths[0].Style.ClipNonZeroWinding {
+		t.Error("expected evenodd clip rule")
+	}
+	if refs := s.ClipPaths["nested"].SvgPaths[0].Style.ClipPaths; len(refs) != 1 || refs[0].ID != "half" {
+		t.Errorf("expected clip path clipped by half, got %v", refs)
+	}
+	stroked := s.SvgPaths[1].Style.ClipPaths
+	if len(stroked) != 1 || stroked[0].Bounds != (Bounds{X: 10, Y: 10, W: 80, H: 80}) || stroked[0].Transform.E != 100 {
+		t.Errorf("unexpected clip reference %+v", stroked[0])
+	}
+	// the clip path of a group applies to its descendants, in the user space of the group
+	scaled := s.SvgPaths[4].Style.ClipPaths
+	if len(scaled) != 1 || scaled[0].Transform != (Matrix2D{A: 0.5, D: 0.5, E: 100, F: 100}) {
+		t.Errorf("unexpected clip reference %+v", scaled[0])
+	}
+	// basic shapes are not supported, and follow the error mode
+	const shape = `<svg viewBox="0 0 10 10"><rect width="5" height="5" clip-path="circle(50%)"/></svg>`
+	if _, err := Parse(strings.NewReader(shape), StrictErrorMode); err == nil {
+		t.Error("expected an error for the basic shape")
+	}
+	if s, err := Parse(strings.NewReader(shape), IgnoreErrorMode); err != nil || len(s.SvgPaths) != 1 || len(s.SvgPaths[0].Style.ClipPaths) != 0 {
+		t.Errorf("expected the basic shape to be ignored, got %v", err)
+	}
+}
+
+func TestPattern(t *testing.T) {
+	s := parseSvg(t, "testdata/pattern.svg")
+	if len(s.SvgPaths) != 4 {
+		t.Fatalf("expected 4 paths, got %d", len(s.SvgPaths))
+	}
+	dots, ok := s.SvgPaths[0].Style.FillerColor.(*TilePattern)
+	if !ok || dots.ID != "dots" || dots.Units != UserSpaceOnUse || len(dots.SvgPaths) != 2 {
+		t.Fatalf("unexpected fill %+v", s.SvgPaths[0].Style.FillerColor)
+	}
+	if tile, content := dots.Tile(s.SvgPaths[0].Path.Bounds()); tile != (Bounds{W: 20, H: 20}) || content != Identity {
+		t.Errorf("unexpected tile %v %v", tile, content)
+	}
+	// tile and content in objectBoundingBox units
+	checker := s.SvgPaths[1].Style.FillerColor.(*TilePattern)
+	tile, content := checker.Tile(s.SvgPaths[1].Path.Bounds())
+	if tile != (Bounds{X: 110, Y: 10, W: 20, H: 20}) || content != (Matrix2D{A: 80, D: 80, E: 110, F: 10}) {
+		t.Errorf("unexpected tile %v %v", tile, content)
+	}
+	// attributes and content inherited through href, with a forward reference
+	stripes := s.SvgPaths[2].Style.FillerColor.(*TilePattern)
+	if stripes.W != 10 || stripes.ViewBox != (Bounds{W: 2, H: 2}) || len(stripes.SvgPaths) != 1 || math.Abs(stripes.Matrix.B-math.Sqrt2/2) > 1e-9 {
+		t.Errorf("unexpected inherited pattern %+v", stripes)
+	}
+	if _, content := stripes.Tile(Bounds{}); content != (Matrix2D{A: 5, D: 5}) {
+		t.Errorf("unexpected view box transform %v", content)
+	}
+	if _, ok := s.SvgPaths[3].Style.LinerColor.(*TilePattern); !ok {
+		t.Error("expected a stroke pattern")
+	}
+	// a pattern painted with itself is not painted
+	if loop := s.patterns["loop"].SvgPaths[0].Style; loop.FillerColor != nil || loop.LinerColor == nil {
+		t.Errorf("unexpected self reference %+v", loop)
+	}
+}
+
+func TestImage(t *testing.T) {
+	s := parseSvg(t, "testdata/image.svg")
+	if len(s.Images) != 4 || len(s.SvgPaths) != 2 {
+		t.Fatalf("expected 4 images and 2 paths, got %d and %d", len(s.Images), len(s.SvgPaths))
+	}
+	for i, index := range []int{1, 2, 2, 2} {
+		if s.Images[i].Index != index {
+			t.Errorf("image %d: expected index %d, got %d", i, index, s.Images[i].Index)
+		}
+	}
+	if size := s.Images[3].Image.Bounds(); size.Dx() != 2 || size.Dy() != 2 {
+		t.Errorf("unexpected jpeg size %v", size)
+	}
+	// the 4x2 image is centered in its viewport
+	if b := s.Images[0].Visible(); b != (Bounds{X: 10, Y: 30, W: 80, H: 40}) {
+		t.Errorf("unexpected visible part %v", b)
+	}
+	if b := s.Images[1].Visible(); b != (Bounds{X: 110, Y: 10, W: 80, H: 80}) || s.Images[1].Style.Opacity != 0.5 {
+		t.Errorf("unexpected visible part %v", b)
+	}
+	if b := s.Images[2].Visible(); b != (Bounds{X: 10, Y: 110, W: 80, H: 80}) {
+		t.Errorf("unexpected visible part %v", b)
+	}
+	if m := s.Images[2].Matrix(); m != (Matrix2D{A: 40, D: 40, E: 10, F: 110}) {
+		t.Errorf("unexpected image transform %v", m)
+	}
+	if refs := s.Images[3].Style.ClipPaths; len(refs) != 1 || refs[0].Bounds != (Bounds{X: 110, Y: 110, W: 80, H: 80}) {
+		t.Errorf("unexpected clip reference %v", refs)
+	}
+}
+
+func TestAspectRatio(t *testing.T) {
+	box := Bounds{W: 10, H: 20}
+	viewport := Bounds{X: 5, Y: 5, W: 40, H: 20}
+	for _, test := range []struct {
+		value string
+		m     Matrix2D
+	}{
+		{"xMidYMid", Matrix2D{A: 1, D: 1, E: 20, F: 5}},
+		{"xMinYMax meet", Matrix2D{A: 1, D: 1, E: 5, F: 5}},
+		{"defer xMaxYMin", Matrix2D{A: 1, D: 1, E: 35, F: 5}},
+		{"xMidYMid slice", Matrix2D{A: 4, D: 4, E: 5, F: -25}},
+		{"none", Matrix2D{A: 4, D: 1, E: 5, F: 5}},
+	} {
+		a, err := parseAspectRatio(test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := a.Transform(box, viewport); m != test.m {
+			t.Errorf("%s: expected %v, got %v", test.value, test.m, m)
+		}
+	}
+	for _, value := range []string{"", "xMidYmid", "none meet slice", "xMinYMin cover"} {
+		if _, err := parseAspectRatio(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+
+	s, err := Parse(strings.NewReader(`<svg viewBox="0 0 10 20" preserveAspectRatio="xMaxYMin slice"/>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.AspectRatio != (AspectRatio{X: AlignMax, Y: AlignMin, Slice: true}) {
+		t.Errorf("unexpected root aspect ratio %+v", s.AspectRatio)
+	}
+	// an invalid value follows the error mode, and is replaced by the default
+	const invalid = `<svg viewBox="0 0 10 20" preserveAspectRatio="xMaxYMin cover"><rect width="1" height="1"/></svg>`
+	if _, err = Parse(strings.NewReader(invalid), StrictErrorMode); err == nil {
+		t.Error("expected an error")
+	}
+	if s, err = Parse(strings.NewReader(invalid), IgnoreErrorMode); err != nil || len(s.SvgPaths) != 1 {
+		t.Fatalf("expected the document to be read, got %v", err)
+	}
+	if s.AspectRatio != (AspectRatio{}) {
+		t.Errorf("expected the default aspect ratio, got %+v", s.AspectRatio)
+	}
+}
+
+func TestSymbol(t *testing.T) {
+	s := parseSvg(t, "testdata/symbol.svg")
+	if len(s.SvgPaths) != 6 {
+		t.Fatalf("expected 6 paths, got %d", len(s.SvgPaths))
+	}
+	for i, test := range []struct {
+		x, y float64 // the bottom right corner of the view box of the symbol
+		fill color.Color
+	}{
+		{100, 100, color.NRGBA{0xff, 0, 0, 0xff}},
+		{30, 30, color.NRGBA{0xff, 0, 0, 0xff}},
+		{90, 30, color.NRGBA{0, 0, 0xff, 0xff}},
+	} {
+		p := s.SvgPaths[2*i]
+		vx, vy := 10.0, 10.0
+		if i == 2 {
+			vx = 20
+		}
+		if x, y := p.Style.Transform.Transform(vx, vy); math.Abs(x-test.x) > 1e-9 || math.Abs(y-test.y) > 1e-9 {
+			t.Errorf("use %d: expected (%g, %g), got (%g, %g)", i, test.x, test.y, x, y)
+		}
+		if p.Style.FillerColor.(PlainColor).NRGBA != test.fill {
+			t.Errorf("use %d: unexpected fill %v", i, p.Style.FillerColor)
+		}
+	}
+
+	// the content is clipped to the viewport of the symbol
+	refs := s.SvgPaths[2].Style.ClipPaths
+	if len(refs) != 1 || s.ClipPaths[refs[0].ID] == nil {
+		t.Fatalf("expected the viewport clip path, got %v", refs)
+	}
+	if b := s.ClipPaths[refs[0].ID].SvgPaths[0].Path.Bounds(); b != (Bounds{W: 20, H: 20}) || refs[0].Transform.E != 10 {
+		t.Errorf("unexpected viewport %v, transformed by %v", b, refs[0].Transform)
+	}
+	// percentages are relative to the view box of the symbol
+	percent, err := Parse(strings.NewReader(`<svg viewBox="0 0 200 200">
+		<symbol id="s" viewBox="0 0 10 10" overflow="visible"><rect width="50%" height="50%"/></symbol>
+		<use href="#s" width="100" height="100"/>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := percent.SvgPaths[0]; p.Path.Bounds() != (Bounds{W: 5, H: 5}) || len(p.Style.ClipPaths) != 0 {
+		t.Errorf("unexpected content %v, clipped by %v", p.Path.Bounds(), p.Style.ClipPaths)
+	}
+
+	box, err := s.Symbol("box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if box.ViewBox != (Bounds{W: 10, H: 10}) || len(box.SvgPaths) != 2 || box.SvgPaths[0].Style.Transform != Identity {
+		t.Errorf("unexpected symbol %+v", box)
+	}
+	if _, err = s.Symbol("missing"); err == nil {
+		t.Error("expected an error for a missing symbol")
+	}
+
+	// extracting a symbol does not change the document
+	doc, err := Parse(strings.NewReader(`<svg viewBox="0 0 10 10">
+		<symbol id="icon" viewBox="0 0 10 10">
+			<clipPath id="inner"><rect width="5" height="5"/></clipPath>
+			<linearGradient id="g" x2="1"><stop offset="0" stop-color="red"/></linearGradient>
+			<rect width="10" height="10" clip-path="url(#inner)" fill="url(#g)"/>
+		</symbol>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, n := doc.ClipPaths["inner"], len(doc.ClipPaths)
+	direction := Linear{0, 0, 1, 0}
+	for i := 0; i < 2; i++ {
+		icon, err := doc.Symbol("icon")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.ClipPaths["inner"] != inner || len(doc.ClipPaths) != n {
+			t.Error("unexpected change of the clip paths of the document")
+		}
+		if g := doc.grads["g"]; g.Direction != direction {
+			t.Errorf("unexpected change of the gradient of the document %v", g.Direction)
+		}
+		if icon.ClipPaths["inner"] == nil || len(icon.SvgPaths) != 1 {
+			t.Fatalf("unexpected symbol %+v", icon)
+		}
+		if g, ok := icon.SvgPaths[0].Style.FillerColor.(Gradient); !ok || g.Direction != direction {
+			t.Errorf("unexpected fill of the symbol %v", icon.SvgPaths[0].Style.FillerColor)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	for _, test := range []struct {
+		transform string
+		x, y      float64
+	}{
+		// the items of a list are applied from right to left
+		{"translate(10,0) scale(2)", 12, 0},
+		{"scale(2) translate(10,0)", 22, 0},
+		{"rotate(90) translate(10)", 0, 11},
+		{"matrix(1 0 0 1 3 4), scale(3)", 6, 4},
+		// the translation of the left matrix is not scaled by the right one
+		{"translate(1,1) scale(2)", 3, 1},
+		{"matrix(2 0 0 3 1 1) matrix(3 0 0 2 1 1)", 9, 4},
+		// the vertical translation is 0 when omitted
+		{"translate(5)", 6, 0},
+		{"translate(5) rotate(90)", 5, 1},
+		// rotations around a point
+		{"rotate(90, 5, 5)", 10, 1},
+		{"rotate(180 1 1)", 1, 2},
+		{"scale(2) rotate(90, 5, 5)", 20, 2},
+	} {
+		s, err := Parse(strings.NewReader(`<svg viewBox="0 0 10 10"><g transform="`+test.transform+`"><path d="M1,0"/></g></svg>`), StrictErrorMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, y := s.SvgPaths[0].Style.Transform.Transform(1, 0)
+		if math.Abs(x-test.x) > 1e-9 || math.Abs(y-test.y) > 1e-9 {
+			t.Errorf("%s: expected (%g, %g), got (%g, %g)", test.transform, test.x, test.y, x, y)
+		}
+	}
+}
+
+func TestUse(t *testing.T) {
+	s, err := Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<use href="#pair" x="50" transform="scale(2)"/>
+		<g id="pair">
+			<rect id="square" width="5" height="5"/>
+			<use href="#square" x="10" y="10"/>
+		</g>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the use of the pair, then the pair itself
+	if len(s.SvgPaths) != 4 {
+		t.Fatalf("expected 4 paths, got %d", len(s.SvgPaths))
+	}
+	for i, test := range []struct{ x, y float64 }{{100, 0}, {120, 20}, {0, 0}, {10, 10}} {
+		if x, y := s.SvgPaths[i].Style.Transform.Transform(0, 0); math.Abs(x-test.x) > 1e-9 || math.Abs(y-test.y) > 1e-9 {
+			t.Errorf("path %d: expected (%g, %g), got (%g, %g)", i, test.x, test.y, x, y)
+		}
+	}
+
+	if _, err = Parse(strings.NewReader(`<svg><g id="loop"><use href="#loop"/></g></svg>`), StrictErrorMode); err == nil {
+		t.Error("expected an error for a cyclic use")
+	}
+}
+
+func TestNestedSvg(t *testing.T) {
+	s, err := Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<svg x="10" y="10" width="50%" height="50" viewBox="0 0 10 10">
+			<rect width="100%" height="5"/>
+		</svg>
+		<svg x="60" y="60" overflow="visible"><rect width="50%" height="1"/></svg>
+		<rect width="50%" height="1"/>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ViewBox != (Bounds{W: 100, H: 100}) || len(s.SvgPaths) != 3 {
+		t.Fatalf("unexpected view box %v or %d paths", s.ViewBox, len(s.SvgPaths))
+	}
+	for i, test := range []struct {
+		x, y  float64 // the bottom right corner of the rectangle
+		clips int
+	}{
+		{60, 35, 1},
+		{110, 61, 0},
+		{50, 1, 0},
+	} {
+		p := s.SvgPaths[i]
+		b := p.Path.Bounds()
+		if x, y := p.Style.Transform.Transform(b.X+b.W, b.Y+b.H); math.Abs(x-test.x) > 1e-9 || math.Abs(y-test.y) > 1e-9 {
+			t.Errorf("path %d: expected (%g, %g), got (%g, %g)", i, test.x, test.y, x, y)
+		}
+		if len(p.Style.ClipPaths) != test.clips {
+			t.Errorf("path %d: expected %d clip paths, got %d", i, test.clips, len(p.Style.ClipPaths))
+		}
+	}
+	if cp := s.ClipPaths[s.SvgPaths[0].Style.ClipPaths[0].ID]; cp == nil || cp.SvgPaths[0].Path.Bounds() != (Bounds{X: 10, Y: 10, W: 50, H: 50}) {
+		t.Errorf("unexpected viewport clip %v", cp)
+	}
+}
+
+func TestMarker(t *testing.T) {
+	s, err := Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="5" markerHeight="5" orient="auto-start-reverse">
+			<path d="M0,0 L10,5 L0,10 z" fill="context-stroke"/>
+		</marker>
+		<marker id="dot" markerUnits="userSpaceOnUse" overflow="visible"><circle r="1"/></marker>
+		<path d="M10,10 H50 V50" stroke="red" stroke-width="2" marker-start="url(#arrow)" marker-mid="url(#dot)" marker-end="url(#arrow)"/>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SvgPaths) != 4 {
+		t.Fatalf("expected 4 paths, got %d", len(s.SvgPaths))
+	}
+	red := NewPlainColor(0xff, 0, 0, 0xff)
+	for i, test := range []struct {
+		x, y  float64 // where the reference point of the marker is drawn
+		clips int
+	}{
+		{10, 10, 1},
+		{50, 10, 0},
+		{50, 50, 1},
+	} {
+		p := s.SvgPaths[i+1]
+		refX, refY := 10.0, 5.0
+		if i == 1 {
+			refX, refY = 0, 0
+		}
+		if x, y := p.Style.Transform.Transform(refX, refY); math.Abs(x-test.x) > 1e-9 || math.Abs(y-test.y) > 1e-9 {
+			t.Errorf("marker %d: expected (%g, %g), got (%g, %g)", i, test.x, test.y, x, y)
+		}
+		if len(p.Style.ClipPaths) != test.clips {
+			t.Errorf("marker %d: expected %d clip paths, got %d", i, test.clips, len(p.Style.ClipPaths))
+		}
+		if i != 1 && p.Style.FillerColor != red {
+			t.Errorf("marker %d: expected the stroke of the path as fill, got %v", i, p.Style.FillerColor)
+		}
+	}
+	// the start marker is reversed, pointing to the left, and the
+	// end one points downward, both scaled by the stroke width
+	if x, y := s.SvgPaths[1].Style.Transform.TransformVector(10, 0); math.Abs(x+10) > 1e-9 || math.Abs(y) > 1e-9 {
+		t.Errorf("unexpected start marker direction (%g, %g)", x, y)
+	}
+	if x, y := s.SvgPaths[3].Style.Transform.TransformVector(10, 0); math.Abs(x) > 1e-9 || math.Abs(y-10) > 1e-9 {
+		t.Errorf("unexpected end marker direction (%g, %g)", x, y)
+	}
+
+	// markers are clipped with their path, whose bounding box they do not extend
+	s, err = Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<clipPath id="c" clipPathUnits="objectBoundingBox"><rect width="0.5" height="1"/></clipPath>
+		<marker id="dot" markerUnits="userSpaceOnUse" overflow="visible"><circle r="5"/></marker>
+		<path d="M10,10 H50 V50" stroke="red" clip-path="url(#c)" marker-start="url(#dot)" marker-end="url(#dot)"/>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SvgPaths) != 3 {
+		t.Fatalf("expected 3 paths, got %d", len(s.SvgPaths))
+	}
+	ref := s.SvgPaths[0].Style.ClipPaths[0]
+	for i, p := range s.SvgPaths[1:] {
+		if len(p.Style.ClipPaths) != 1 || p.Style.ClipPaths[0] != ref {
+			t.Errorf("marker %d: expected the clip path of the path, got %v", i, p.Style.ClipPaths)
+		}
+	}
+	if ref.Bounds != (Bounds{X: 10, Y: 10, W: 40, H: 40}) {
+		t.Errorf("unexpected clip bounds %v", ref.Bounds)
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	const doc = `<svg viewBox="0 0 100 100">
+		<switch>
+			<rect systemLanguage="fr, de-CH" width="1" height="1"/>
+			<rect systemLanguage="en-US" width="2" height="2"/>
+			<rect requiredExtensions="http://example.org/ext" width="3" height="3"/>
+			<g><rect width="4" height="4"/><rect width="5" height="5"/></g>
+		</switch>
+		<rect systemLanguage="en" requiredFeatures="http://www.w3.org/TR/SVG11/feature#Shape" width="6" height="6"/>
+	</svg>`
+	for _, test := range []struct {
+		languages []string
+		widths    []float64
+	}{
+		{nil, []float64{4, 5}},
+		{[]string{"de"}, []float64{1}},
+		{[]string{"EN", "fr"}, []float64{1, 6}},
+		{[]string{"en"}, []float64{2, 6}},
+		{[]string{"en-GB"}, []float64{4, 5}},
+	} {
+		s, err := Parse(strings.NewReader(doc), StrictErrorMode, Languages(test.languages...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var widths []float64
+		for _, p := range s.SvgPaths {
+			widths = append(widths, p.Path.Bounds().W)
+		}
+		if fmt.Sprint(widths) != fmt.Sprint(test.widths) {
+			t.Errorf("%v: expected widths %v, got %v", test.languages, test.widths, widths)
+		}
+	}
+}
+
+func TestLinks(t *testing.T) {
+	s, err := Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<a href="https://example.org/a" target="_blank">
+			<rect x="10" y="10" width="20" height="10"/>
+			<a xlink:href="#b"><circle cx="50" cy="50" r="5"/></a>
+		</a>
+		<rect width="100" height="100"/>
+		<a href="#c" transform="rotate(90)"><rect width="10" height="20"/></a>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions := s.LinkRegions(Identity.Scale(2, 2))
+	if len(regions) != 3 {
+		t.Fatalf("expected 3 regions, got %d", len(regions))
+	}
+	for i, test := range []struct {
+		link   Link
+		bounds Bounds
+	}{
+		{Link{Href: "https://example.org/a", Target: "_blank"}, Bounds{X: 20, Y: 20, W: 40, H: 20}},
+		{Link{Href: "#b"}, Bounds{X: 90, Y: 90, W: 20, H: 20}},
+		{Link{Href: "#c"}, Bounds{X: -40, Y: 0, W: 40, H: 20}},
+	} {
+		r := regions[i]
+		if *r.Link != test.link {
+			t.Errorf("region %d: expected link %+v, got %+v", i, test.link, *r.Link)
+		}
+		b := r.Bounds
+		if math.Abs(b.X-test.bounds.X) > 0.05 || math.Abs(b.Y-test.bounds.Y) > 0.05 || math.Abs(b.W-test.bounds.W) > 0.05 || math.Abs(b.H-test.bounds.H) > 0.05 {
+			t.Errorf("region %d: expected bounds %v, got %v", i, test.bounds, b)
+		}
+	}
+}
+
+func TestView(t *testing.T) {
+	s, err := Parse(strings.NewReader(`<svg viewBox="0 0 100 50">
+		<view id="left" viewBox="0 0 50 50"/>
+		<defs><view id="right" viewBox="50 0 50 50" preserveAspectRatio="xMinYMin slice"/></defs>
+		<rect width="100" height="50"/>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		fragment    string
+		box         Bounds
+		aspectRatio AspectRatio
+	}{
+		{"left", Bounds{W: 50, H: 50}, AspectRatio{}},
+		{"#right", Bounds{X: 50, W: 50, H: 50}, AspectRatio{X: AlignMin, Y: AlignMin, Slice: true}},
+		{"#svgView(viewBox(10, 10, 20, 20))", Bounds{X: 10, Y: 10, W: 20, H: 20}, AspectRatio{}},
+		{"svgView(preserveAspectRatio(none);zoomAndPan(magnify))", Bounds{W: 100, H: 50}, AspectRatio{None: true}},
+	} {
+		v, err := s.View(test.fragment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.ViewBox != test.box || v.AspectRatio != test.aspectRatio || len(v.SvgPaths) != 1 {
+			t.Errorf("%s: unexpected view %v %+v", test.fragment, v.ViewBox, v.AspectRatio)
+		}
+	}
+	if s.ViewBox != (Bounds{W: 100, H: 50}) {
+		t.Errorf("the view box of the document changed to %v", s.ViewBox)
+	}
+	for _, fragment := range []string{"missing", "svgView(viewBox(0,0,1))", "svgView(transform(scale(2)))"} {
+		if _, err = s.View(fragment); err == nil {
+			t.Errorf("%s: expected an error", fragment)
+		}
+	}
+}
+
+func TestForeignElements(t *testing.T) {
+	const doc = `<svg xmlns="http://www.w3.org/2000/svg" xmlns:sodipodi="http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd" viewBox="0 0 10 10">
+		<sodipodi:namedview><rect width="1" height="1"/></sodipodi:namedview>
+		<metadata><rect width="2" height="2"/></metadata>
+		<switch>
+			<foreignObject requiredFeatures="http://www.w3.org/TR/SVG11/feature#Extensibility"><rect width="3" height="3"/></foreignObject>
+			<rect width="4" height="4"/>
+		</switch>
+	</svg>`
+	s, err := Parse(strings.NewReader(doc), IgnoreErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SvgPaths) != 1 || s.SvgPaths[0].Path.Bounds().W != 4 {
+		t.Fatalf("expected only the fallback of the switch, got %d paths", len(s.SvgPaths))
+	}
+
+	// foreign namespaces are ignored by default, unlike unsupported svg elements
+	if _, err = Parse(strings.NewReader(doc), StrictErrorMode); err == nil || !strings.Contains(err.Error(), "metadata") {
+		t.Errorf("expected an error for the metadata element, got %v", err)
+	}
+	_, err = Parse(strings.NewReader(doc), StrictErrorMode, Namespace(SvgNamespace, IgnoreErrorMode),
+		Namespace("http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd", StrictErrorMode))
+	if err == nil || !strings.Contains(err.Error(), "namedview") {
+		t.Errorf("expected an error for the namedview element, got %v", err)
+	}
+	if _, err = Parse(strings.NewReader(doc), StrictErrorMode, Namespace(SvgNamespace, IgnoreErrorMode)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGradientHref(t *testing.T) {
+	s, err := Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<rect width="10" height="10" fill="url(#later)" stroke="url(#tiles)"/>
+		<rect width="10" height="10" fill="url(#radial)"/>
+		<defs>
+			<linearGradient id="later" href="#base" x2="50%" gradientUnits="userSpaceOnUse"/>
+			<linearGradient id="base" xlink:href="#later" y2="100" spreadMethod="reflect">
+				<stop offset="0" stop-color="red"/><stop offset="1" stop-color="blue"/>
+			</linearGradient>
+			<radialGradient id="radial" href="#base" cx="20%"/>
+			<pattern id="tiles" width="5" height="5"><rect width="1" height="1"/></pattern>
+		</defs>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linear, ok := s.SvgPaths[0].Style.FillerColor.(Gradient)
+	if !ok {
+		t.Fatalf("expected a gradient, got %v", s.SvgPaths[0].Style.FillerColor)
+	}
+	if len(linear.Stops) != 2 || linear.Spread != ReflectSpread || linear.Units != UserSpaceOnUse ||
+		linear.Direction != (Linear{0, 0, 50, 100}) {
+		t.Errorf("unexpected inherited gradient %+v", linear)
+	}
+	if _, ok := s.SvgPaths[0].Style.LinerColor.(*TilePattern); !ok {
+		t.Errorf("expected a pattern, got %v", s.SvgPaths[0].Style.LinerColor)
+	}
+	radial, ok := s.SvgPaths[1].Style.FillerColor.(Gradient)
+	if !ok {
+		t.Fatalf("expected a gradient, got %v", s.SvgPaths[1].Style.FillerColor)
+	}
+	// only the attributes common to both kinds of gradients are inherited
+	if len(radial.Stops) != 2 || radial.Spread != ReflectSpread || radial.Units != UserSpaceOnUse ||
+		radial.Direction != (Radial{20, 50, 20, 50, 50, 50}) {
+		t.Errorf("unexpected inherited gradient %+v", radial)
+	}
+}
+
+func TestMeshGradient(t *testing.T) {
+	s, err := Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<defs>
+			<meshgradient id="mesh" x="10" y="10" gradientUnits="userSpaceOnUse" type="bicubic">
+				<meshrow>
+					<meshpatch>
+						<stop path="l 40,0" stop-color="red"/>
+						<stop path="c 0,10 0,30 0,40" stop-color="lime"/>
+						<stop path="L 10,50" stop-color="blue"/>
+						<stop stop-color="yellow"/>
+					</meshpatch>
+					<meshpatch>
+						<stop path="l 40,0"/>
+						<stop path="l 0,40" stop-color="white"/>
+						<stop path="l -40,0" stop-color="black" stop-opacity="0.5"/>
+					</meshpatch>
+				</meshrow>
+			</meshgradient>
+		</defs>
+		<rect width="100" height="100" fill="url(#mesh)"/>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mesh, ok := s.SvgPaths[0].Style.FillerColor.(*MeshGradient)
+	if !ok {
+		t.Fatalf("expected a mesh gradient, got %v", s.SvgPaths[0].Style.FillerColor)
+	}
+	if !mesh.Bicubic || mesh.Units != UserSpaceOnUse || len(mesh.Patches) != 1 || len(mesh.Patches[0]) != 2 {
+		t.Fatalf("unexpected mesh gradient %+v", mesh)
+	}
+	first, second := mesh.Patches[0][0], mesh.Patches[0][1]
+	// the omitted path closes the first patch
+	if first.Edges[3][0] != (MeshPoint{10, 50}) || first.Edges[3][3] != (MeshPoint{10, 10}) {
+		t.Errorf("unexpected left edge %v", first.Edges[3])
+	}
+	if first.Edges[1][1] != (MeshPoint{50, 20}) || first.Edges[1][3] != (MeshPoint{50, 50}) {
+		t.Errorf("unexpected right edge %v", first.Edges[1])
+	}
+	// the left edge of the second patch is the right edge of the first one
+	if second.Edges[3] != [4]MeshPoint{first.Edges[1][3], first.Edges[1][2], first.Edges[1][1], first.Edges[1][0]} {
+		t.Errorf("unexpected shared edge %v", second.Edges[3])
+	}
+	if second.Edges[2][3] != (MeshPoint{50, 50}) {
+		t.Errorf("unexpected bottom edge %v", second.Edges[2])
+	}
+	red, lime := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 255, 0, 255}
+	blue := color.NRGBA{0, 0, 255, 255}
+	if first.Colors != [4]color.NRGBA{red, lime, blue, {255, 255, 0, 255}} {
+		t.Errorf("unexpected colors %v", first.Colors)
+	}
+	// the colors of the corners shared with the first patch are its own
+	if second.Colors != [4]color.NRGBA{lime, {255, 255, 255, 255}, {0, 0, 0, 127}, blue} {
+		t.Errorf("unexpected colors %v", second.Colors)
+	}
+	if c := mesh.Color(0, 1, 0, 0); c != lime {
+		t.Errorf("unexpected color at corner %v", c)
+	}
+	if p := second.Point(0.5, 0.5); math.Abs(p.X-70) > 1e-9 || math.Abs(p.Y-30) > 1e-9 {
+		t.Errorf("unexpected center %v", p)
+	}
+}
+
+func TestAnimation(t *testing.T) {
+	s, err := Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<rect id="box" width="10" height="10" fill="red" style="opacity: 0.5">
+			<animate id="grow" attributeName="width" from="10" to="50" dur="2s" fill="freeze"/>
+			<animate attributeName="fill" values="red;blue" begin="grow.end" dur="1s"/>
+			<set attributeName="opacity" to="1" begin="1s" dur="1s"/>
+		</rect>
+		<g>
+			<path d="M0,0 L10,0 L10,10 Z"/>
+			<animateTransform attributeName="transform" type="rotate" from="0 50 50" to="360 50 50"
+				dur="4s" repeatCount="indefinite"/>
+			<animateMotion path="M0,0 L100,0" dur="1s" begin="0.5s" rotate="auto"/>
+		</g>
+		<animate href="#box" attributeName="x" by="5" dur="1s" repeatCount="2" accumulate="sum" fill="freeze"/>
+		<animate attributeName="opacity" values="0;1" begin="click" dur="1s"/>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Animations) != 7 {
+		t.Fatalf("expected 7 animations, got %d", len(s.Animations))
+	}
+	if d := s.Duration(); d != 4*time.Second {
+		t.Errorf("unexpected duration %v", d)
+	}
+	attr := func(snapshot *Svg, index int, name string) string {
+		return attrValue(snapshot.doc.tokens[s.Animations[index].target].(xml.StartElement).Attr, name)
+	}
+	for _, test := range []struct {
+		at          time.Duration
+		index       int
+		name, value string
+	}{
+		{0, 0, "width", "10"},
+		{time.Second, 0, "width", "30"},
+		{3 * time.Second, 0, "width", "50"},                   // frozen
+		{2500 * time.Millisecond, 1, "fill", "#800080"},       // begins at the end of grow
+		{3500 * time.Millisecond, 1, "fill", "red"},           // removed
+		{1500 * time.Millisecond, 2, "opacity", "1"},          // overrides the style attribute
+		{5 * time.Second, 3, "transform", "rotate(90 50 50)"}, // repeated
+		{2 * time.Second, 3, "transform", "rotate(180 50 50)"},
+		{time.Second, 4, "transform", "rotate(90 50 50) translate(50,0) rotate(0)"},
+		{500 * time.Millisecond, 5, "x", "2.5"},
+		{1500 * time.Millisecond, 5, "x", "7.5"}, // accumulated
+		{5 * time.Second, 5, "x", "10"},
+		{time.Second, 6, "opacity", ""}, // never begins
+	} {
+		snapshot, err := s.At(test.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := attr(snapshot, test.index, test.name); got != test.value {
+			t.Errorf("at %v, expected %s=%q, got %q", test.at, test.name, test.value, got)
+		}
+	}
+	snapshot, err := s.At(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if style := snapshot.SvgPaths[0].Style; style.Opacity != 1 || snapshot.SvgPaths[0].Path.Bounds().W != 30 {
+		t.Errorf("unexpected snapshot %v %v", style.Opacity, snapshot.SvgPaths[0].Path)
+	}
+	// snapshots of snapshots are taken from the original document
+	if snapshot, err = snapshot.At(0); err != nil {
+		t.Fatal(err)
+	}
+	if got := attr(snapshot, 0, "width"); got != "10" {
+		t.Errorf("unexpected width %s", got)
+	}
+
+	// invalid animated values follow the error mode of the image
+	const invalid = `<svg viewBox="0 0 100 100">
+		<rect width="10" height="10"><set attributeName="stroke-linecap" to="flat" dur="1s"/></rect>
+	</svg>`
+	for _, mode := range []ErrorMode{StrictErrorMode, IgnoreErrorMode} {
+		s, err := Parse(strings.NewReader(invalid), mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snapshot, err := s.At(0)
+		if (err != nil) != (mode == StrictErrorMode) {
+			t.Errorf("mode %d: unexpected error %v", mode, err)
+		}
+		if len(snapshot.SvgPaths) != 1 && mode == IgnoreErrorMode {
+			t.Errorf("mode %d: expected the rect, got %d paths", mode, len(snapshot.SvgPaths))
+		}
+	}
+}
+
+func TestCSSAnimation(t *testing.T) {
+	s, err := Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<style>
+			@keyframes spin { to { transform: rotate(1turn) } }
+			@keyframes pulse {
+				0%, 100% { opacity: 1; fill: #ff0000 }
+				50% { opacity: 0.5; fill: #0000ff; animation-timing-function: steps(2) }
+			}
+			@keyframes dash { from { stroke-dashoffset: 100 } }
+			g > .spinner { animation: spin 2s linear infinite; transform-origin: 50px 50px }
+			#dot { animation-name: pulse; animation-duration: 1s; animation-timing-function: linear }
+			path { animation: dash 1s ease-in-out 1s alternate 2 both }
+		</style>
+		<g><rect class="spinner" width="10" height="10"/></g>
+		<circle id="dot" r="5"/>
+		<path d="M0,0 L100,0" stroke="black" style="stroke-dashoffset: 20"/>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Animations) != 4 {
+		t.Fatalf("expected 4 animations, got %d", len(s.Animations))
+	}
+	attr := func(snapshot *Svg, index int, name string) string {
+		return attrValue(snapshot.doc.tokens[s.Animations[index].target].(xml.StartElement).Attr, name)
+	}
+	for _, test := range []struct {
+		at          time.Duration
+		index       int
+		name, value string
+	}{
+		{500 * time.Millisecond, 0, "transform", "translate(50,50) rotate(90) translate(-50,-50)"},
+		{2500 * time.Millisecond, 0, "transform", "translate(50,50) rotate(90) translate(-50,-50)"},
+		{250 * time.Millisecond, 1, "opacity", "0.75"},
+		{250 * time.Millisecond, 2, "fill", "#800080"},
+		{600 * time.Millisecond, 2, "fill", "#0000ff"},          // steps
+		{1500 * time.Millisecond, 1, "opacity", ""},             // not filled
+		{500 * time.Millisecond, 3, "stroke-dashoffset", "100"}, // backwards
+		{1500 * time.Millisecond, 3, "stroke-dashoffset", "60"}, // ease-in-out
+		{2500 * time.Millisecond, 3, "stroke-dashoffset", "60"}, // alternate
+		{4 * time.Second, 3, "stroke-dashoffset", "100"},        // forwards, at the end of the reversed iteration
+	} {
+		snapshot, err := s.At(test.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := attr(snapshot, test.index, test.name); got != test.value {
+			t.Errorf("at %v, expected %s=%q, got %q", test.at, test.name, test.value, got)
+		}
+	}
+}
+
+func TestDisplayVisibility(t *testing.T) {
+	s, err := Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<defs>
+			<g id="icon"><rect width="1" height="1"/><rect width="2" height="2" style="display: none"/></g>
+		</defs>
+		<g display="none">
+			<rect width="3" height="3"/>
+			<linearGradient id="grad"><stop offset="0" stop-color="red"/></linearGradient>
+			<svg><rect width="4" height="4"/></svg>
+		</g>
+		<g visibility="hidden">
+			<rect width="5" height="5" fill="url(#grad)"/>
+			<rect width="6" height="6" visibility="visible" fill="url(#grad)"/>
+		</g>
+		<clipPath id="clip"><rect width="7" height="7" display="none"/><rect width="8" height="8"/></clipPath>
+		<text display="none">hidden</text>
+		<use href="#icon"/>
+		<rect width="9" height="9"/>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var widths []float64
+	for _, p := range s.SvgPaths {
+		widths = append(widths, p.Path.Bounds().W)
+	}
+	if fmt.Sprint(widths) != "[6 1 9]" {
+		t.Errorf("unexpected paths of widths %v", widths)
+	}
+	if _, ok := s.SvgPaths[0].Style.FillerColor.(Gradient); !ok {
+		t.Errorf("expected the gradient of an undisplayed group, got %v", s.SvgPaths[0].Style.FillerColor)
+	}
+	if clip := s.ClipPaths["clip"]; len(clip.SvgPaths) != 1 || clip.SvgPaths[0].Path.Bounds().W != 8 {
+		t.Errorf("unexpected clip path %v", clip.SvgPaths)
+	}
+
+	// inherit takes the value of the parent
+	s, err = Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<g visibility="hidden">
+			<rect width="1" height="1" visibility="inherit"/>
+			<g visibility="visible"><rect width="2" height="2" visibility="inherit"/></g>
+		</g>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SvgPaths) != 1 || s.SvgPaths[0].Path.Bounds().W != 2 {
+		t.Errorf("expected the visible rect only, got %v", s.SvgPaths)
+	}
+	c := newSvgCursor(&Svg{}, StrictErrorMode, parseOptions{})
+	for _, display := range []string{"none", "inherit"} {
+		if err := c.pushStyle([]xml.Attr{{Name: xml.Name{Local: "display"}, Value: display}}); err != nil {
+			t.Fatal(err)
+		}
+		if !c.styleStack[len(c.styleStack)-1].displayNone {
+			t.Errorf("display %s: expected an undisplayed element", display)
+		}
+	}
+}
+
+func TestPaintOrder(t *testing.T) {
+	for v, exp := range map[string]PaintOrder{
+		"normal":              PaintNormal,
+		"stroke":              PaintStrokeFillMarkers,
+		"markers stroke":      PaintMarkersStrokeFill,
+		"fill markers":        PaintFillMarkersStroke,
+		"stroke fill markers": PaintStrokeFillMarkers,
+	} {
+		if got, ok := parsePaintOrder(v); !ok || got != exp {
+			t.Errorf("paint-order %q: expected %v, got %v", v, exp, got)
+		}
+	}
+	for _, v := range []string{"", "fill fill", "normal stroke", "stroke fill markers fill"} {
+		if _, ok := parsePaintOrder(v); ok {
+			t.Errorf("paint-order %q: expected an invalid value", v)
+		}
+	}
+
+	s, err := Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<marker id="dot"><rect width="1" height="1"/></marker>
+		<g style="paint-order: stroke">
+			<path d="M10 10 H50" fill="red" stroke="blue"/>
+		</g>
+		<path d="M10 10 H60" fill="red" stroke="blue" marker-end="url(#dot)" paint-order="fill markers"/>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SvgPaths) != 4 {
+		t.Fatalf("unexpected number of paths %d", len(s.SvgPaths))
+	}
+	if p := s.SvgPaths[0]; !p.Style.PaintOrder.StrokeFirst() || p.Style.FillerColor == nil || p.Style.LinerColor == nil {
+		t.Errorf("expected an inherited stroke first order, got %v", p.Style.PaintOrder)
+	}
+	fill, marker, stroke := s.SvgPaths[1], s.SvgPaths[2], s.SvgPaths[3]
+	if fill.Style.FillerColor == nil || fill.Style.LinerColor != nil {
+		t.Errorf("expected the fill below the markers, got %v", fill.Style)
+	}
+	if marker.Path.Bounds().W != 1 {
+		t.Errorf("expected the marker between the fill and the stroke, got %v", marker.Path)
+	}
+	if stroke.Style.FillerColor != nil || stroke.Style.LinerColor == nil {
+		t.Errorf("expected the stroke above the markers, got %v", stroke.Style)
+	}
+
+	// a split element has a single link region
+	s, err = Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<a href="#top"><path d="M10 10 H60" fill="red" stroke="blue" paint-order="fill markers"/></a>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SvgPaths) != 2 {
+		t.Fatalf("unexpected number of paths %d", len(s.SvgPaths))
+	}
+	if regions := s.LinkRegions(Identity); len(regions) != 1 || regions[0].Link.Href != "#top" {
+		t.Errorf("expected a single link region, got %v", regions)
+	}
+}
+
+func TestNonScalingStroke(t *testing.T) {
+	s, err := Parse(strings.NewReader(`<svg viewBox="0 0 100 100">
+		<g vector-effect="non-scaling-stroke" transform="scale(4)">
+			<path d="M10 10 H50" stroke="blue" stroke-width="2" stroke-dasharray="1 3" stroke-dashoffset="1"/>
+			<path d="M10 10 H50" stroke="blue" stroke-width="2" stroke-dasharray="1 3" stroke-dashoffset="1"
+				style="vector-effect: non-scaling-stroke"/>
+		</g>
+	</svg>`), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SvgPaths) != 2 {
+		t.Fatalf("unexpected number of paths %d", len(s.SvgPaths))
+	}
+	target := Identity.Scale(0.5, 0.5)
+	for i, exp := range []float64{4, 2} {
+		style := s.SvgPaths[i].Style
+		if w := style.DeviceLineWidth(target.Mult(style.Transform)); w != exp {
+			t.Errorf("path %d: expected a stroke width of %v, got %v", i, exp, w)
+		}
+		// the dashes are scaled as the width
+		scale := exp / 2
+		if dash, offset := style.DeviceDash(target.Mult(style.Transform)); fmt.Sprint(dash, offset) != fmt.Sprint([]float64{scale, 3 * scale}, scale) {
+			t.Errorf("path %d: unexpected dashes %v %v", i, dash, offset)
+		}
+	}
+}
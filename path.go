@@ -2,6 +2,7 @@ package svg
 
 import (
 	"fmt"
+	"math"
 	"strings"
 
 	"golang.org/x/image/math/fixed"
@@ -73,6 +74,20 @@ func (p Path) String() string {
 	return p.ToSVGPath()
 }
 
+// Bounds returns the bounding box of the path.
+func (p Path) Bounds() Bounds {
+	pl := flattenPath(p, Identity)
+	if len(pl) == 0 {
+		return Bounds{}
+	}
+	minX, minY, maxX, maxY := pl[0].x, pl[0].y, pl[0].x, pl[0].y
+	for _, pt := range pl[1:] {
+		minX, maxX = math.Min(minX, pt.x), math.Max(maxX, pt.x)
+		minY, maxY = math.Min(minY, pt.y), math.Max(maxY, pt.y)
+	}
+	return Bounds{X: minX, Y: minY, W: maxX - minX, H: maxY - minY}
+}
+
 // Clear zeros the path slice
 func (p *Path) Clear() {
 	*p = (*p)[:0]
@@ -1,7 +1,6 @@
 package svg
 
 import (
-	"encoding/xml"
 	"image/color"
 	"strconv"
 	"strings"
@@ -12,7 +11,7 @@ import (
 
 // This file defines colors and gradients used in SVG
 
-// Pattern groups a basic color and a gradient pattern
+// Pattern groups a basic color, a gradient and a tile pattern
 // A nil value may by used to indicated that the function (fill or stroke) is off
 type Pattern interface {
 	isPattern()
@@ -177,6 +176,9 @@ type Gradient struct {
 	Matrix    Matrix2D
 	Spread    SpreadMethod
 	Units     GradientUnits
+
+	href  string
+	attrs map[string]string // own attributes, before href inheritance
 }
 
 // ApplyPathExtent use the given path extent to adjust the bounding box,
@@ -252,44 +254,219 @@ func localizeGradIfStopClrNil(g *Gradient, defaultColor Pattern) Gradient {
 	return grad
 }
 
-// readGradURL reads an SVG format gradient url
+// paintRef is a reference to a paint server of the document being
+// parsed, which is only known once the whole document is read
+type paintRef struct {
+	id           string
+	defaultColor Pattern // used for the stops of gradients without color
+}
+
+func (paintRef) isPattern() {}
+
+// readPaintURL reads an SVG paint server url, referencing
+// either a gradient or a pattern.
 // Since the context of the gradient can affect the colors
 // the current fill or line color is passed in and used in
 // the case of a nil stopClor value
-func (c *svgCursor) readGradURL(v string, defaultColor Pattern) (grad Gradient, ok bool) {
-	if strings.HasPrefix(v, "url(") && strings.HasSuffix(v, ")") {
-		urlStr := strings.TrimSpace(v[4 : len(v)-1])
-		if strings.HasPrefix(urlStr, "#") {
-			var g *Gradient
-			g, ok = c.svg.grads[urlStr[1:]]
-			if ok {
-				grad = localizeGradIfStopClrNil(g, defaultColor)
+func (c *svgCursor) readPaintURL(v string, defaultColor Pattern) (paint Pattern, ok bool, err error) {
+	if !strings.HasPrefix(v, "url(") || !strings.HasSuffix(v, ")") {
+		return nil, false, nil
+	}
+	doc, id, err := c.document(v[4 : len(v)-1])
+	if doc == nil {
+		return nil, false, err
+	}
+	if doc == c.svg {
+		// paint servers may be declared later in the document
+		if _, ok := c.svg.doc.ids[id]; ok {
+			return paintRef{id: id, defaultColor: defaultColor}, true, nil
+		}
+		return nil, false, nil
+	}
+	return doc.paintServer(id, defaultColor), true, nil
+}
+
+// paintServer returns the gradient or pattern with the given id,
+// or nil if there is none
+func (s *Svg) paintServer(id string, defaultColor Pattern) Pattern {
+	if g, ok := s.grads[id]; ok {
+		return localizeGradIfStopClrNil(g, defaultColor)
+	}
+	if p, ok := s.patterns[id]; ok {
+		return p
+	}
+	if m, ok := s.meshes[id]; ok {
+		return m
+	}
+	return nil
+}
+
+// gradientAttrs are the attributes of a gradient inherited through href
+var gradientAttrs = [...]string{
+	"gradientUnits", "gradientTransform", "spreadMethod",
+	"x1", "y1", "x2", "y2", "cx", "cy", "r", "fx", "fy", "fr",
+}
+
+// resolveGradients applies the attributes and stops inherited
+// through href, once the whole document is known.
+func (c *svgCursor) resolveGradients() error {
+	for _, g := range c.svg.grads {
+		// the chain of referenced gradients, without cycles
+		chain := []*Gradient{g}
+		for q := g; strings.HasPrefix(q.href, "#"); {
+			var ok bool
+			if q, ok = c.svg.grads[q.href[1:]]; !ok || containsGradient(chain, q) {
+				break
+			}
+			chain = append(chain, q)
+		}
+		attrs := make(map[string]string)
+		for i := len(chain) - 1; i >= 0; i-- {
+			for k, v := range chain[i].attrs {
+				attrs[k] = v
+			}
+		}
+		for _, q := range chain {
+			if len(q.Stops) > 0 {
+				g.Stops = q.Stops
+				break
 			}
 		}
+		if err := c.compileGradient(g, attrs); err != nil {
+			return err
+		}
 	}
-	return
+	return nil
+}
+
+func containsGradient(chain []*Gradient, g *Gradient) bool {
+	for _, q := range chain {
+		if q == g {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePaints replaces the references to the paint servers of
+// the document by the gradients and patterns they designate
+func (c *svgCursor) resolvePaints() {
+	resolve := func(paint *Pattern) {
+		ref, ok := (*paint).(paintRef)
+		if !ok {
+			return
+		}
+		defaultColor := ref.defaultColor
+		if r, ok := defaultColor.(paintRef); ok {
+			defaultColor = c.svg.paintServer(r.id, nil)
+		}
+		*paint = c.svg.paintServer(ref.id, defaultColor)
+	}
+	resolvePaths := func(paths []SvgPath) {
+		for i := range paths {
+			resolve(&paths[i].Style.FillerColor)
+			resolve(&paths[i].Style.LinerColor)
+		}
+	}
+	resolvePaths(c.svg.SvgPaths)
+	for _, m := range c.svg.SvgMasks {
+		resolvePaths(m.SvgPaths)
+	}
+	for _, p := range c.svg.patterns {
+		resolvePaths(p.SvgPaths)
+	}
+}
+
+// compileGradient sets the fields of the gradient from its attributes
+func (c *svgCursor) compileGradient(g *Gradient, attrs map[string]string) error {
+	for _, name := range [...]string{"gradientTransform", "gradientUnits", "spreadMethod"} {
+		if v, ok := attrs[name]; ok {
+			if err := c.readGradAttr(g, name, v); err != nil {
+				return err
+			}
+		}
+	}
+	// interpretation of percentage in direction depends on gradientUnits
+	bbox := Bounds{W: 1, H: 1} // default is ObjectBoundingBox
+	if g.Units == UserSpaceOnUse {
+		bbox = g.Bounds
+	}
+	// resolve returns the value of the attribute, or its default value
+	resolve := func(name, defaultValue string, asPerc percentageReference) (float64, error) {
+		v, ok := attrs[name]
+		if !ok {
+			v = defaultValue
+		}
+		return bbox.resolveUnit(v, asPerc)
+	}
+	var err error
+	switch g.Direction.(type) {
+	case Linear:
+		var direction Linear
+		for i, v := range [...]struct {
+			name, defaultValue string
+			asPerc             percentageReference
+		}{
+			{"x1", "0%", widthPercentage},
+			{"y1", "0%", heightPercentage},
+			{"x2", "100%", widthPercentage},
+			{"y2", "0", heightPercentage},
+		} {
+			if direction[i], err = resolve(v.name, v.defaultValue, v.asPerc); err != nil {
+				return err
+			}
+		}
+		g.Direction = direction
+	case Radial:
+		// fx and fy default to cx and cy
+		cx, cy := "50%", "50%"
+		if v, ok := attrs["cx"]; ok {
+			cx = v
+		}
+		if v, ok := attrs["cy"]; ok {
+			cy = v
+		}
+		var direction Radial
+		for i, v := range [...]struct {
+			name, defaultValue string
+			asPerc             percentageReference
+		}{
+			{"cx", "50%", widthPercentage},
+			{"cy", "50%", heightPercentage},
+			{"fx", cx, widthPercentage},
+			{"fy", cy, heightPercentage},
+			{"r", "50%", diagPercentage},
+			{"fr", "50%", diagPercentage},
+		} {
+			if direction[i], err = resolve(v.name, v.defaultValue, v.asPerc); err != nil {
+				return err
+			}
+		}
+		g.Direction = direction
+	}
+	return nil
 }
 
 // readGradAttr reads an SVG gradient attribute
-func (c *svgCursor) readGradAttr(attr xml.Attr) (err error) {
-	switch attr.Name.Local {
+func (c *svgCursor) readGradAttr(g *Gradient, name, value string) (err error) {
+	switch name {
 	case "gradientTransform":
-		c.grad.Matrix, err = c.parseTransform(attr.Value)
+		g.Matrix, err = c.parseTransformFrom(Identity, value)
 	case "gradientUnits":
-		switch strings.TrimSpace(attr.Value) {
+		switch strings.TrimSpace(value) {
 		case "userSpaceOnUse":
-			c.grad.Units = UserSpaceOnUse
+			g.Units = UserSpaceOnUse
 		case "objectBoundingBox":
-			c.grad.Units = ObjectBoundingBox
+			g.Units = ObjectBoundingBox
 		}
 	case "spreadMethod":
-		switch strings.TrimSpace(attr.Value) {
+		switch strings.TrimSpace(value) {
 		case "pad":
-			c.grad.Spread = PadSpread
+			g.Spread = PadSpread
 		case "reflect":
-			c.grad.Spread = ReflectSpread
+			g.Spread = ReflectSpread
 		case "repeat":
-			c.grad.Spread = RepeatSpread
+			g.Spread = RepeatSpread
 		}
 	}
 	return
@@ -0,0 +1,143 @@
+package renderer
+
+import (
+	"image"
+	"math"
+
+	"github.com/golang/freetype/raster"
+	"github.com/lafriks/go-svg"
+	"golang.org/x/image/math/fixed"
+)
+
+// maxClipDepth limits the nesting of clip paths, which may be cyclic
+const maxClipDepth = 16
+
+// ClipMask returns the coverage of the clip paths applied to style, in the device
+// space given by target, and limited to bounds. It returns nil if the style is
+// not clipped. References to missing clip paths are ignored.
+func ClipMask(s *svg.Svg, style *svg.PathStyle, target svg.Matrix2D, bounds image.Rectangle) *image.Alpha {
+	return clipMask(s, style.ClipPaths, target, bounds, 0)
+}
+
+// clipMask returns the intersection of the clip paths of refs, whose
+// transforms are relative to m
+func clipMask(s *svg.Svg, refs []*svg.ClipRef, m svg.Matrix2D, bounds image.Rectangle, depth int) *image.Alpha {
+	var mask *image.Alpha
+	for _, ref := range refs {
+		cp, ok := s.ClipPaths[ref.ID]
+		if !ok {
+			continue
+		}
+		region := image.NewAlpha(bounds)
+		if depth < maxClipDepth {
+			cm := m.Mult(cp.Matrix(ref))
+			for _, p := range cp.SvgPaths {
+				cov := coverage(p.Path, cm.Mult(p.Style.Transform), p.Style.ClipNonZeroWinding, bounds)
+				if nested := clipMask(s, p.Style.ClipPaths, cm, bounds, depth+1); nested != nil {
+					intersectAlpha(cov, nested)
+				}
+				unionAlpha(region, cov)
+			}
+		}
+		if mask == nil {
+			mask = region
+		} else {
+			intersectAlpha(mask, region)
+		}
+	}
+	return mask
+}
+
+// DeviceBounds returns the pixels the path, transformed by m, may cover.
+func DeviceBounds(svgp svg.SvgPath, m svg.Matrix2D) image.Rectangle {
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	add := func(x, y float64) {
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+	}
+	for _, op := range svgp.Path {
+		// the curves lie within the hull of their control points
+		switch op := op.(type) {
+		case svg.OpMoveTo:
+			add(m.Transform(float64(op.X)/64, float64(op.Y)/64))
+		case svg.OpLineTo:
+			add(m.Transform(float64(op.X)/64, float64(op.Y)/64))
+		case svg.OpQuadTo:
+			for _, p := range op {
+				add(m.Transform(float64(p.X)/64, float64(p.Y)/64))
+			}
+		case svg.OpCubicTo:
+			for _, p := range op {
+				add(m.Transform(float64(p.X)/64, float64(p.Y)/64))
+			}
+		}
+	}
+	if minX > maxX {
+		return image.Rectangle{}
+	}
+	if svgp.Style.LinerColor != nil {
+		margin := svgp.Style.DeviceLineWidth(m) / 2 * math.Max(float64(svgp.Style.Join.MiterLimit)/64, 1.5)
+		minX, minY, maxX, maxY = minX-margin, minY-margin, maxX+margin, maxY+margin
+	}
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX))+1, int(math.Ceil(maxY))+1)
+}
+
+// unionAlpha adds the coverage of src to dst
+func unionAlpha(dst, src *image.Alpha) {
+	for i, a := range src.Pix {
+		b := dst.Pix[i]
+		dst.Pix[i] = uint8(int(a) + int(b) - (int(a)*int(b)+127)/255)
+	}
+}
+
+// intersectAlpha restricts the coverage of dst to src
+func intersectAlpha(dst, src *image.Alpha) {
+	for i, a := range src.Pix {
+		dst.Pix[i] = uint8((int(a)*int(dst.Pix[i]) + 127) / 255)
+	}
+}
+
+// coverage returns the anti-aliased coverage of the path, transformed by m
+// and filled with the given rule, within bounds.
+func coverage(p svg.Path, m svg.Matrix2D, nonZero bool, bounds image.Rectangle) *image.Alpha {
+	// the rasterizer of golang.org/x/image/vector, also used by rasterx,
+	// only implements the nonzero rule
+	r := raster.NewRasterizer(bounds.Dx(), bounds.Dy())
+	r.UseNonZeroWinding = nonZero
+	// the rasterizer is positioned at the origin of bounds
+	m = svg.Identity.Translate(-float64(bounds.Min.X), -float64(bounds.Min.Y)).Mult(m)
+	var start, last fixed.Point26_6
+	open := false
+	closePath := func() {
+		// filled paths are implicitly closed
+		if open && last != start {
+			r.Add1(start)
+		}
+		last = start
+	}
+	for _, op := range p {
+		switch op := op.(type) {
+		case svg.OpMoveTo:
+			closePath()
+			start = m.TFixed(fixed.Point26_6(op))
+			last, open = start, true
+			r.Start(start)
+		case svg.OpLineTo:
+			last = m.TFixed(fixed.Point26_6(op))
+			r.Add1(last)
+		case svg.OpQuadTo:
+			last = m.TFixed(op[1])
+			r.Add2(m.TFixed(op[0]), last)
+		case svg.OpCubicTo:
+			last = m.TFixed(op[2])
+			r.Add3(m.TFixed(op[0]), m.TFixed(op[1]), last)
+		case svg.OpClose:
+			closePath()
+		}
+	}
+	closePath()
+	mask := image.NewAlpha(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	r.Rasterize(raster.NewAlphaSrcPainter(mask))
+	mask.Rect = bounds
+	return mask
+}
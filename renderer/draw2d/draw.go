@@ -1,27 +1,36 @@
 package draw2d
 
 import (
+	"image"
 	"image/color"
+	"image/draw"
 
 	"github.com/lafriks/go-svg"
 	"github.com/lafriks/go-svg/renderer"
 
 	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dimg"
 )
 
 // Draw the parsed SVG into the graphic context with the specified options.
 func Draw(gc draw2d.GraphicContext, s *svg.Svg, opts ...renderer.RenderOption) {
 	opt := renderer.Options(s, opts...)
-	for _, svgp := range s.SvgPaths {
-		drawTransformed(gc, svgp, opt)
+	images := s.Images
+	for i, svgp := range s.SvgPaths {
+		for ; len(images) > 0 && images[0].Index <= i; images = images[1:] {
+			drawImage(gc, s, &images[0], opt)
+		}
+		drawTransformed(gc, s, svgp, opt)
+	}
+	for i := range images {
+		drawImage(gc, s, &images[i], opt)
 	}
 }
 
 func drawTo(gc draw2d.GraphicContext, op svg.Operation, m svg.Matrix2D) {
 	switch op := op.(type) {
 	case svg.OpMoveTo:
-		gc.Close()
-		gc.BeginPath()
+		// starts a sub path, keeping the previous ones
 		t := m.MoveTo(op)
 		gc.MoveTo(float64(t.X)/64, float64(t.Y)/64)
 	case svg.OpLineTo:
@@ -72,9 +81,156 @@ func toGradient(g svg.Gradient, opacity float64) color.Color {
 }
 
 // drawTransformed draws the compiled SvgPath into the driver while applying transform t.
-func drawTransformed(gc draw2d.GraphicContext, svgp svg.SvgPath, opt *renderer.RenderOptions) {
-	m := svgp.Style.Transform.Mult(opt.Target)
+func drawTransformed(gc draw2d.GraphicContext, s *svg.Svg, svgp svg.SvgPath, opt *renderer.RenderOptions) {
+	m := opt.Target.Mult(svgp.Style.Transform)
+	if len(svgp.Style.ClipPaths) == 0 && !offscreenPaint(svgp.Style.FillerColor) && !offscreenPaint(svgp.Style.LinerColor) {
+		drawPath(gc, svgp, m, opt.Opacity)
+		return
+	}
+	bounds := renderer.DeviceBounds(svgp, m)
+	offM := svg.Identity.Translate(-float64(bounds.Min.X), -float64(bounds.Min.Y)).Mult(m)
+	drawOffscreen(gc, s, &svgp.Style, opt, bounds, func(off *image.RGBA) {
+		fill, stroke := svgp, svgp
+		fill.Style.LinerColor, stroke.Style.FillerColor = nil, nil
+		parts := [2]svg.SvgPath{fill, stroke}
+		if svgp.Style.PaintOrder.StrokeFirst() {
+			parts[0], parts[1] = stroke, fill
+		}
+		for _, part := range parts {
+			if !drawPainted(off, s, part, opt, offM, bounds) {
+				drawPath(draw2dimg.NewGraphicContext(off), part, offM, opt.Opacity)
+			}
+		}
+	})
+}
+
+// drawImage draws the image element into the driver.
+func drawImage(gc draw2d.GraphicContext, s *svg.Svg, img *svg.SvgImage, opt *renderer.RenderOptions) {
+	m := opt.Target.Mult(img.Style.Transform)
+	// the visible part of the image is filled with it
+	shape := svg.SvgPath{Path: img.Path(), Style: img.Style}
+	shape.Style.FillerColor, shape.Style.LinerColor = svg.NewPlainColor(0xff, 0xff, 0xff, 0xff), nil
+	shape.Style.UseNonZeroWinding = true
+	bounds := renderer.DeviceBounds(shape, m)
+	offM := svg.Identity.Translate(-float64(bounds.Min.X), -float64(bounds.Min.Y)).Mult(m)
+	drawOffscreen(gc, s, &img.Style, opt, bounds, func(off *image.RGBA) {
+		paintShape(off, shape, offM, renderer.NewImage(img, opt.Target, img.Style.Opacity*opt.Opacity), bounds.Min)
+	})
+}
+
+// drawOffscreen draws into an image covering bounds, in device space, then
+// copies it into the driver through the clip mask of the style.
+func drawOffscreen(gc draw2d.GraphicContext, s *svg.Svg, style *svg.PathStyle, opt *renderer.RenderOptions, bounds image.Rectangle, render func(off *image.RGBA)) {
+	if bounds.Empty() {
+		return
+	}
+	off := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	render(off)
+	if mask := renderer.ClipMask(s, style, opt.Target, bounds); mask != nil {
+		clipped := image.NewRGBA(off.Bounds())
+		draw.DrawMask(clipped, clipped.Bounds(), off, image.Point{}, mask, bounds.Min, draw.Src)
+		off = clipped
+	}
+
+	gc.Save()
+	gc.ComposeMatrixTransform(draw2d.NewTranslationMatrix(float64(bounds.Min.X), float64(bounds.Min.Y)))
+	gc.DrawImage(off)
+	gc.Restore()
+}
+
+// offscreenPaint reports whether the pattern has no color of
+// draw2d, and is painted offscreen by drawPainted
+func offscreenPaint(p svg.Pattern) bool {
+	switch p.(type) {
+	case *svg.TilePattern, *svg.MeshGradient:
+		return true
+	}
+	return false
+}
+
+// drawPainted paints the path, which is either filled or stroked, into off
+// if its paint is a tile pattern or a mesh gradient, and reports whether it
+// did. The image off covers bounds, in device space.
+func drawPainted(off *image.RGBA, s *svg.Svg, svgp svg.SvgPath, opt *renderer.RenderOptions, m svg.Matrix2D, bounds image.Rectangle) bool {
+	var (
+		p     paint
+		ok    bool
+		shape = svgp
+	)
+	switch c := svgp.Style.FillerColor.(type) {
+	case *svg.TilePattern:
+		if tile := renderer.NewTile(c, &svgp, opt.Target, svgp.Style.FillOpacity*opt.Opacity, drawTile(s)); tile != nil {
+			p = tile
+		}
+		ok, shape.Style.LinerColor = true, nil
+	case *svg.MeshGradient:
+		p = renderer.NewMesh(c, &svgp, opt.Target, bounds, svgp.Style.FillOpacity*opt.Opacity)
+		ok, shape.Style.LinerColor = true, nil
+	}
+	if !ok {
+		switch c := svgp.Style.LinerColor.(type) {
+		case *svg.TilePattern:
+			if tile := renderer.NewTile(c, &svgp, opt.Target, svgp.Style.LineOpacity*opt.Opacity, drawTile(s)); tile != nil {
+				p = tile
+			}
+			ok, shape.Style.FillerColor = true, nil
+		case *svg.MeshGradient:
+			p = renderer.NewMesh(c, &svgp, opt.Target, bounds, svgp.Style.LineOpacity*opt.Opacity)
+			ok, shape.Style.FillerColor = true, nil
+		}
+	}
+	if p != nil {
+		paintShape(off, shape, m, p, bounds.Min)
+	}
+	return ok
+}
+
+// paint is a color varying in device space
+type paint interface {
+	ColorAt(x, y int) color.Color
+}
+
+// paintShape paints the shape, which is either filled or stroked, into off.
+// The shape coverage is drawn in opaque white, then used as a mask.
+func paintShape(off *image.RGBA, shape svg.SvgPath, m svg.Matrix2D, p paint, origin image.Point) {
+	white := svg.NewPlainColor(0xff, 0xff, 0xff, 0xff)
+	if shape.Style.FillerColor != nil {
+		shape.Style.FillerColor, shape.Style.FillOpacity = white, 1
+	}
+	if shape.Style.LinerColor != nil {
+		shape.Style.LinerColor, shape.Style.LineOpacity = white, 1
+	}
+	cov := image.NewRGBA(off.Bounds())
+	drawPath(draw2dimg.NewGraphicContext(cov), shape, m, 1)
+	draw.DrawMask(off, off.Bounds(), paintImage{p, origin}, image.Point{}, cov, image.Point{}, draw.Over)
+}
+
+// paintImage is a paint seen as an image, whose origin is
+// at the given device pixel
+type paintImage struct {
+	paint
+	origin image.Point
+}
+
+func (p paintImage) ColorModel() color.Model { return color.RGBA64Model }
 
+func (p paintImage) Bounds() image.Rectangle {
+	return image.Rect(-1e9, -1e9, 1e9, 1e9)
+}
+
+func (p paintImage) At(x, y int) color.Color {
+	return p.ColorAt(x+p.origin.X, y+p.origin.Y)
+}
+
+// drawTile returns the function drawing the content of pattern tiles
+func drawTile(s *svg.Svg) renderer.DrawFunc {
+	return func(dst *image.RGBA, svgp svg.SvgPath, target svg.Matrix2D) {
+		drawTransformed(draw2dimg.NewGraphicContext(dst), s, svgp, &renderer.RenderOptions{Opacity: 1, Target: target})
+	}
+}
+
+// drawPath draws the path into the driver while applying transform m.
+func drawPath(gc draw2d.GraphicContext, svgp svg.SvgPath, m svg.Matrix2D, opacity float64) {
 	if svgp.Style.FillerColor != nil {
 		var fr draw2d.FillRule
 		if svgp.Style.UseNonZeroWinding {
@@ -83,9 +239,9 @@ func drawTransformed(gc draw2d.GraphicContext, svgp svg.SvgPath, opt *renderer.R
 		gc.SetFillRule(fr)
 		switch c := svgp.Style.FillerColor.(type) {
 		case svg.PlainColor:
-			gc.SetFillColor(toColor(c, svgp.Style.FillOpacity*opt.Opacity))
+			gc.SetFillColor(toColor(c, svgp.Style.FillOpacity*opacity))
 		case svg.Gradient:
-			gc.SetFillColor(toGradient(c, svgp.Style.FillOpacity*opt.Opacity))
+			gc.SetFillColor(toGradient(c, svgp.Style.FillOpacity*opacity))
 		}
 	}
 	if svgp.Style.LinerColor != nil {
@@ -93,12 +249,12 @@ func drawTransformed(gc draw2d.GraphicContext, svgp svg.SvgPath, opt *renderer.R
 		gc.SetLineJoin(toLineJoin(svgp.Style.Join.LineJoin))
 		switch c := svgp.Style.LinerColor.(type) {
 		case svg.PlainColor:
-			gc.SetStrokeColor(toColor(c, svgp.Style.LineOpacity*opt.Opacity))
+			gc.SetStrokeColor(toColor(c, svgp.Style.LineOpacity*opacity))
 		case svg.Gradient:
-			gc.SetStrokeColor(toGradient(c, svgp.Style.LineOpacity*opt.Opacity))
+			gc.SetStrokeColor(toGradient(c, svgp.Style.LineOpacity*opacity))
 		}
-		gc.SetLineWidth(svgp.Style.LineWidth * m.LineWidthScale())
-		gc.SetLineDash(svgp.Style.Dash.Dash, svgp.Style.Dash.DashOffset)
+		gc.SetLineWidth(svgp.Style.DeviceLineWidth(m))
+		gc.SetLineDash(svgp.Style.DeviceDash(m))
 	}
 
 	for _, op := range svgp.Path {
@@ -106,10 +262,17 @@ func drawTransformed(gc draw2d.GraphicContext, svgp svg.SvgPath, opt *renderer.R
 	}
 
 	if svgp.Style.FillerColor != nil {
-		if svgp.Style.LinerColor != nil {
-			gc.FillStroke()
-		} else {
+		if svgp.Style.LinerColor == nil {
+			gc.Fill()
+		} else if svgp.Style.PaintOrder.StrokeFirst() {
+			gc.Stroke()
+			// stroking consumes the path
+			for _, op := range svgp.Path {
+				drawTo(gc, op, m)
+			}
 			gc.Fill()
+		} else {
+			gc.FillStroke()
 		}
 	} else if svgp.Style.LinerColor != nil {
 		gc.Stroke()
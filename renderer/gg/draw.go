@@ -3,6 +3,7 @@ package gg
 import (
 	"image"
 	"image/color"
+	"image/draw"
 
 	"github.com/lafriks/go-svg"
 	"github.com/lafriks/go-svg/renderer"
@@ -13,8 +14,19 @@ import (
 // Draw the parsed SVG into the graphic context with the specified options.
 func Draw(gc *gg.Context, s *svg.Svg, opts ...renderer.RenderOption) error {
 	opt := renderer.Options(s, opts...)
-	for _, svgp := range s.SvgPaths {
-		if err := drawTransformed(gc, s, svgp, svgp.Style.Transform.Mult(opt.Target), opt.Opacity); err != nil {
+	images := s.Images
+	for i, svgp := range s.SvgPaths {
+		for ; len(images) > 0 && images[0].Index <= i; images = images[1:] {
+			if err := drawImage(gc, s, &images[0], opt.Target, opt.Opacity); err != nil {
+				return err
+			}
+		}
+		if err := drawTransformed(gc, s, svgp, opt.Target.Mult(svgp.Style.Transform), opt.Target, opt.Opacity); err != nil {
+			return err
+		}
+	}
+	for i := range images {
+		if err := drawImage(gc, s, &images[i], opt.Target, opt.Opacity); err != nil {
 			return err
 		}
 	}
@@ -88,26 +100,17 @@ func toGradient(g svg.Gradient, opacity float64) gg.Gradient {
 	return grad
 }
 
-// drawTransformed draws the compiled SvgPath into the driver while applying transform t.
-func drawTransformed(gc *gg.Context, s *svg.Svg, svgp svg.SvgPath, m svg.Matrix2D, opacity float64) error {
-	var mask *image.Alpha
-	if len(svgp.Style.Masks) > 0 {
-		m, err := getMask(s, svgp.Style.Masks, gc.Image().Bounds(), m)
-		if err != nil {
-			return err
-		}
-		mask = m
+// drawTransformed draws the compiled SvgPath into the driver while applying transform m.
+// The clip paths of the path are positioned with target.
+func drawTransformed(gc *gg.Context, s *svg.Svg, svgp svg.SvgPath, m, target svg.Matrix2D, opacity float64) error {
+	// the pixels the path may cover, which are the only ones clipped or shaded
+	extent := renderer.DeviceBounds(svgp, m).Intersect(image.Rect(0, 0, gc.Width(), gc.Height()))
+	if err := setMask(gc, s, &svgp.Style, m, target, extent); err != nil {
+		return err
 	}
 
-	if mask != nil {
-		if err := gc.SetMask(mask); err != nil {
-			return err
-		}
-	} else {
-		gc.ResetClip()
-	}
-
-	if svgp.Style.FillerColor != nil {
+	fill, stroke := svgp.Style.FillerColor != nil, svgp.Style.LinerColor != nil
+	if fill {
 		if svgp.Style.UseNonZeroWinding {
 			gc.SetFillRuleWinding()
 		} else {
@@ -118,42 +121,118 @@ func drawTransformed(gc *gg.Context, s *svg.Svg, svgp svg.SvgPath, m svg.Matrix2
 			gc.SetFillStyle(gg.NewSolidPattern(toColor(c, svgp.Style.FillOpacity*opacity)))
 		case svg.Gradient:
 			gc.SetFillStyle(toGradient(c, svgp.Style.FillOpacity*opacity))
+		case *svg.TilePattern:
+			tile := renderer.NewTile(c, &svgp, target, svgp.Style.FillOpacity*opacity, drawTile(s))
+			if tile != nil {
+				gc.SetFillStyle(tile)
+			}
+			fill = tile != nil
+		case *svg.MeshGradient:
+			gc.SetFillStyle(renderer.NewMesh(c, &svgp, target, extent, svgp.Style.FillOpacity*opacity))
 		}
 	}
-	if svgp.Style.LinerColor != nil {
+	if stroke {
 		gc.SetLineCap(toLineCap(svgp.Style.Join.TrailLineCap))
 		gc.SetLineJoin(toLineJoin(svgp.Style.Join.LineJoin))
 		switch c := svgp.Style.LinerColor.(type) {
 		case svg.PlainColor:
-			gc.SetColor(toColor(c, svgp.Style.LineOpacity*opacity))
+			gc.SetStrokeStyle(gg.NewSolidPattern(toColor(c, svgp.Style.LineOpacity*opacity)))
 		case svg.Gradient:
-			gc.SetColor(toColor(svg.GetColor(c), svgp.Style.LineOpacity*opacity))
+			gc.SetStrokeStyle(gg.NewSolidPattern(toColor(svg.GetColor(c), svgp.Style.LineOpacity*opacity)))
+		case *svg.TilePattern:
+			tile := renderer.NewTile(c, &svgp, target, svgp.Style.LineOpacity*opacity, drawTile(s))
+			if tile != nil {
+				gc.SetStrokeStyle(tile)
+			}
+			stroke = tile != nil
+		case *svg.MeshGradient:
+			gc.SetStrokeStyle(renderer.NewMesh(c, &svgp, target, extent, svgp.Style.LineOpacity*opacity))
 		}
-		gc.SetLineWidth(svgp.Style.LineWidth * m.LineWidthScale())
-		gc.SetDash(svgp.Style.Dash.Dash...)
-		gc.SetDashOffset(svgp.Style.Dash.DashOffset)
+		gc.SetLineWidth(svgp.Style.DeviceLineWidth(m))
+		dash, offset := svgp.Style.DeviceDash(m)
+		gc.SetDash(dash...)
+		gc.SetDashOffset(offset)
 	}
 
 	for _, op := range svgp.Path {
 		drawTo(gc, op, m)
 	}
 
-	if svgp.Style.FillerColor != nil {
-		if svgp.Style.LinerColor != nil {
-			gc.FillPreserve()
-		} else {
-			gc.Fill()
+	switch {
+	case fill && stroke && svgp.Style.PaintOrder.StrokeFirst():
+		gc.StrokePreserve()
+		gc.Fill()
+	case fill && stroke:
+		gc.FillPreserve()
+		gc.Stroke()
+	case fill:
+		gc.Fill()
+	case stroke:
+		gc.Stroke()
+	default:
+		gc.ClearPath()
+	}
+
+	return nil
+}
+
+// setMask restricts the drawing to the masks and clip paths of the style.
+// The clip paths are only rasterized over extent, the pixels the shape covers.
+func setMask(gc *gg.Context, s *svg.Svg, style *svg.PathStyle, m, target svg.Matrix2D, extent image.Rectangle) error {
+	var mask *image.Alpha
+	bounds := gc.Image().Bounds()
+	if len(style.Masks) > 0 {
+		m, err := getMask(s, style.Masks, bounds, m, target)
+		if err != nil {
+			return err
+		}
+		mask = m
+	}
+	if clip := renderer.ClipMask(s, style, target, extent.Intersect(bounds)); clip != nil {
+		// gg requires a mask as large as the image
+		full := image.NewAlpha(bounds)
+		draw.Draw(full, clip.Rect, clip, clip.Rect.Min, draw.Src)
+		if mask != nil {
+			for i, a := range full.Pix {
+				full.Pix[i] = uint8(uint32(a) * uint32(mask.Pix[i]) / 255)
+			}
 		}
+		mask = full
 	}
 
-	if svgp.Style.LinerColor != nil {
-		gc.Stroke()
+	if mask != nil {
+		if err := gc.SetMask(mask); err != nil {
+			return err
+		}
+	} else {
+		gc.ResetClip()
 	}
+	return nil
+}
 
+// drawImage draws the image element into the driver.
+func drawImage(gc *gg.Context, s *svg.Svg, img *svg.SvgImage, target svg.Matrix2D, opacity float64) error {
+	m := target.Mult(img.Style.Transform)
+	if err := setMask(gc, s, &img.Style, m, target, renderer.DeviceBounds(svg.SvgPath{Path: img.Path()}, m)); err != nil {
+		return err
+	}
+	gc.SetFillRuleWinding()
+	gc.SetFillStyle(renderer.NewImage(img, target, img.Style.Opacity*opacity))
+	for _, op := range img.Path() {
+		drawTo(gc, op, m)
+	}
+	gc.Fill()
 	return nil
 }
 
-func getMask(s *svg.Svg, masks []string, rectangle image.Rectangle, m svg.Matrix2D) (*image.Alpha, error) {
+// drawTile returns the function drawing the content of pattern tiles
+func drawTile(s *svg.Svg) renderer.DrawFunc {
+	return func(dst *image.RGBA, svgp svg.SvgPath, target svg.Matrix2D) {
+		_ = drawTransformed(gg.NewContextForRGBA(dst), s, svgp, target.Mult(svgp.Style.Transform), target, 1)
+	}
+}
+
+func getMask(s *svg.Svg, masks []string, rectangle image.Rectangle, m, target svg.Matrix2D) (*image.Alpha, error) {
 	gc := gg.NewContext(rectangle.Dx(), rectangle.Dy())
 	mask, ok := s.SvgMasks[masks[len(masks)-1]]
 	if !ok {
@@ -178,7 +257,7 @@ func getMask(s *svg.Svg, masks []string, rectangle image.Rectangle, m svg.Matrix
 	// }
 
 	for _, op := range mask.SvgPaths {
-		if err := drawTransformed(gc, s, op, m, 1); err != nil {
+		if err := drawTransformed(gc, s, op, m, target, 1); err != nil {
 			return nil, err
 		}
 	}
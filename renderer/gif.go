@@ -0,0 +1,44 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+
+	"github.com/lafriks/go-svg"
+)
+
+// RenderFunc renders a snapshot of an animated image.
+type RenderFunc func(snapshot *svg.Svg) image.Image
+
+// EncodeGIF encodes the animation of s as an animated GIF, looping forever.
+// The snapshots taken every interval, from the start of the timeline to its
+// duration, are rendered with render and quantized to the web safe palette.
+// It returns the error of the first snapshot which cannot be read, if any.
+func EncodeGIF(w io.Writer, s *svg.Svg, interval time.Duration, render RenderFunc) error {
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	duration := s.Duration()
+	pal := append(color.Palette{color.Transparent}, palette.WebSafe...)
+	// GIF delays are in hundredths of a second
+	delay := int((interval + 5*time.Millisecond) / (10 * time.Millisecond))
+	anim := &gif.GIF{}
+	for t := time.Duration(0); t == 0 || t < duration; t += interval {
+		snapshot, err := s.At(t)
+		if err != nil {
+			return err
+		}
+		img := render(snapshot)
+		frame := image.NewPaletted(img.Bounds(), pal)
+		draw.FloydSteinberg.Draw(frame, frame.Rect, img, img.Bounds().Min)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+	}
+	return gif.EncodeAll(w, anim)
+}
@@ -0,0 +1,70 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/lafriks/go-svg"
+)
+
+// Image is the paint of an image element, whose visible part is given
+// by its Path method. It implements the Pattern interface of gg.
+type Image struct {
+	img     image.Image
+	device  svg.Matrix2D // from device space to image pixels
+	opacity float64
+}
+
+// NewImage returns the paint of img, in the device space given by target.
+func NewImage(img *svg.SvgImage, target svg.Matrix2D, opacity float64) *Image {
+	m := target.Mult(img.Style.Transform).Mult(img.Matrix())
+	return &Image{img: img.Image, device: m.Invert(), opacity: opacity}
+}
+
+// ColorAt returns the color of the image at the given device pixel,
+// interpolated between its nearest pixels.
+func (i *Image) ColorAt(x, y int) color.Color {
+	px, py := i.device.Transform(float64(x)+0.5, float64(y)+0.5)
+	px, py = px-0.5, py-0.5
+	fx, fy := math.Floor(px), math.Floor(py)
+	tx, ty := px-fx, py-fy
+	b := i.img.Bounds()
+	x0, y0 := clampPixel(fx, b.Min.X, b.Max.X), clampPixel(fy, b.Min.Y, b.Max.Y)
+	x1, y1 := clampPixel(fx+1, b.Min.X, b.Max.X), clampPixel(fy+1, b.Min.Y, b.Max.Y)
+
+	var sum [4]float64
+	for _, s := range [4]struct {
+		x, y   int
+		weight float64
+	}{
+		{x0, y0, (1 - tx) * (1 - ty)},
+		{x1, y0, tx * (1 - ty)},
+		{x0, y1, (1 - tx) * ty},
+		{x1, y1, tx * ty},
+	} {
+		r, g, b, a := i.img.At(s.x, s.y).RGBA()
+		sum[0] += float64(r) * s.weight
+		sum[1] += float64(g) * s.weight
+		sum[2] += float64(b) * s.weight
+		sum[3] += float64(a) * s.weight
+	}
+	return color.RGBA64{
+		R: uint16(sum[0] * i.opacity),
+		G: uint16(sum[1] * i.opacity),
+		B: uint16(sum[2] * i.opacity),
+		A: uint16(sum[3] * i.opacity),
+	}
+}
+
+// clampPixel returns the pixel at f, within [min, max)
+func clampPixel(f float64, min, max int) int {
+	i := int(f)
+	if f < float64(min) {
+		return min
+	}
+	if i >= max {
+		return max - 1
+	}
+	return i
+}
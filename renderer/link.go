@@ -0,0 +1,11 @@
+package renderer
+
+import (
+	"github.com/lafriks/go-svg"
+)
+
+// LinkRegions returns the regions of the links of the image, in the
+// coordinates of the destination drawn with the same options.
+func LinkRegions(s *svg.Svg, opts ...RenderOption) []svg.LinkRegion {
+	return s.LinkRegions(Options(s, opts...).Target)
+}
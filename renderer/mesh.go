@@ -0,0 +1,136 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/lafriks/go-svg"
+)
+
+// maxMeshSubdivisions limits the number of quads each
+// side of a mesh patch is subdivided into
+const maxMeshSubdivisions = 64
+
+// Mesh is a mesh gradient, shaded to paint a path. It
+// implements the Pattern interface of gg.
+type Mesh struct {
+	img     *image.RGBA
+	opacity float64
+}
+
+// NewMesh shades the mesh gradient g, used to paint svgp in the device space
+// given by target, over the device pixels of bounds. Each patch is subdivided
+// into small quads, whose colors are interpolated.
+func NewMesh(g *svg.MeshGradient, svgp *svg.SvgPath, target svg.Matrix2D, bounds image.Rectangle, opacity float64) *Mesh {
+	m := target.Mult(svgp.Style.Transform)
+	if g.Units == svg.ObjectBoundingBox {
+		bbox := svgp.Path.Bounds()
+		m = m.Mult(svg.Matrix2D{A: bbox.W, D: bbox.H, E: bbox.X, F: bbox.Y})
+	}
+	m = m.Mult(g.Matrix)
+
+	img := image.NewRGBA(bounds)
+	for row, patches := range g.Patches {
+		for col := range patches {
+			shadePatch(img, g, row, col, m)
+		}
+	}
+	return &Mesh{img: img, opacity: opacity}
+}
+
+// meshVertex is a shaded point of a patch, in device space
+type meshVertex struct {
+	x, y float64
+	c    [4]float64 // premultiplied color
+}
+
+// shadePatch draws the patch at row and col of g into img
+func shadePatch(img *image.RGBA, g *svg.MeshGradient, row, col int, m svg.Matrix2D) {
+	p := &g.Patches[row][col]
+	// the subdivision depends on the size of the patch on the device
+	var length float64
+	for _, edge := range p.Edges {
+		for i := 1; i < 4; i++ {
+			x0, y0 := m.Transform(edge[i-1].X, edge[i-1].Y)
+			x1, y1 := m.Transform(edge[i].X, edge[i].Y)
+			length = math.Max(length, math.Hypot(x1-x0, y1-y0))
+		}
+	}
+	n := int(math.Ceil(length))
+	if n < 1 {
+		n = 1
+	} else if n > maxMeshSubdivisions {
+		n = maxMeshSubdivisions
+	}
+
+	grid := make([]meshVertex, (n+1)*(n+1))
+	for j := 0; j <= n; j++ {
+		for i := 0; i <= n; i++ {
+			u, v := float64(i)/float64(n), float64(j)/float64(n)
+			pt := p.Point(u, v)
+			x, y := m.Transform(pt.X, pt.Y)
+			c := g.Color(row, col, u, v)
+			a := float64(c.A) / 255
+			grid[j*(n+1)+i] = meshVertex{x: x, y: y, c: [4]float64{
+				float64(c.R) * a, float64(c.G) * a, float64(c.B) * a, float64(c.A),
+			}}
+		}
+	}
+	for j := 0; j < n; j++ {
+		for i := 0; i < n; i++ {
+			v00, v10 := grid[j*(n+1)+i], grid[j*(n+1)+i+1]
+			v01, v11 := grid[(j+1)*(n+1)+i], grid[(j+1)*(n+1)+i+1]
+			fillTriangle(img, v00, v10, v11)
+			fillTriangle(img, v00, v11, v01)
+		}
+	}
+}
+
+// fillTriangle draws the pixels whose center is inside the triangle,
+// interpolating the colors of its vertices
+func fillTriangle(img *image.RGBA, a, b, c meshVertex) {
+	area := (b.x-a.x)*(c.y-a.y) - (c.x-a.x)*(b.y-a.y)
+	if area == 0 {
+		return
+	}
+	r := image.Rect(
+		int(math.Floor(math.Min(a.x, math.Min(b.x, c.x)))),
+		int(math.Floor(math.Min(a.y, math.Min(b.y, c.y)))),
+		int(math.Ceil(math.Max(a.x, math.Max(b.x, c.x))))+1,
+		int(math.Ceil(math.Max(a.y, math.Max(b.y, c.y))))+1,
+	).Intersect(img.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			// barycentric coordinates, with a tolerance so that
+			// the pixels on shared edges are drawn
+			wa := ((b.x-px)*(c.y-py) - (c.x-px)*(b.y-py)) / area
+			wb := ((c.x-px)*(a.y-py) - (a.x-px)*(c.y-py)) / area
+			wc := 1 - wa - wb
+			const eps = -1e-9
+			if wa < eps || wb < eps || wc < eps {
+				continue
+			}
+			var out [4]uint8
+			for k := range out {
+				out[k] = uint8(math.Round(math.Max(0, math.Min(255, wa*a.c[k]+wb*b.c[k]+wc*c.c[k]))))
+			}
+			img.SetRGBA(x, y, color.RGBA{R: out[0], G: out[1], B: out[2], A: out[3]})
+		}
+	}
+}
+
+// ColorAt returns the color of the mesh at the given device pixel.
+func (m *Mesh) ColorAt(x, y int) color.Color {
+	c := m.img.RGBAAt(x, y)
+	if m.opacity >= 1 {
+		return c
+	}
+	return color.RGBA{
+		R: uint8(float64(c.R) * m.opacity),
+		G: uint8(float64(c.G) * m.opacity),
+		B: uint8(float64(c.B) * m.opacity),
+		A: uint8(float64(c.A) * m.opacity),
+	}
+}
@@ -9,6 +9,9 @@ type RenderOptions struct {
 	Opacity float64
 	// Target is the rectangle to render the image within.
 	Target svg.Matrix2D
+
+	target      *svg.Bounds
+	aspectRatio svg.AspectRatio
 }
 
 // RenderOption is a interface for renderer options.
@@ -28,23 +31,40 @@ type targetOption struct {
 }
 
 func (o targetOption) apply(s *svg.Svg, r *RenderOptions) {
-	scaleW := o.W / s.ViewBox.W
-	scaleH := o.H / s.ViewBox.H
-	r.Target = svg.Identity.Translate(o.X-s.ViewBox.X, o.Y-s.ViewBox.Y).Scale(scaleW, scaleH)
+	r.target = &svg.Bounds{X: o.X, Y: o.Y, W: o.W, H: o.H}
 }
 
-// Target specifies the rectangle to draw within.
+// Target specifies the rectangle to draw within. The view box is fitted
+// in it according to the preserveAspectRatio attribute of the document,
+// unless overridden by the AspectRatio option.
 func Target(x, y, w, h float64) RenderOption {
 	return targetOption{X: x, Y: y, W: w, H: h}
 }
 
+type aspectRatioOption svg.AspectRatio
+
+func (o aspectRatioOption) apply(s *svg.Svg, r *RenderOptions) {
+	r.aspectRatio = svg.AspectRatio(o)
+}
+
+// AspectRatio specifies how the view box is fitted in the rectangle given
+// by the Target option, instead of the preserveAspectRatio attribute of the
+// document.
+func AspectRatio(a svg.AspectRatio) RenderOption {
+	return aspectRatioOption(a)
+}
+
 // Options apply the options.
 func Options(s *svg.Svg, opts ...RenderOption) *RenderOptions {
 	r := &RenderOptions{
-		Opacity: 1,
+		Opacity:     1,
+		aspectRatio: s.AspectRatio,
 	}
 	for _, o := range opts {
 		o.apply(s, r)
 	}
+	if r.target != nil {
+		r.Target = r.aspectRatio.Transform(s.ViewBox, *r.target)
+	}
 	return r
 }
@@ -0,0 +1,80 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/lafriks/go-svg"
+)
+
+// maxTileSize limits the size, in pixels, of a rendered tile
+const maxTileSize = 4096
+
+// DrawFunc draws the path into dst, in the device space given by target.
+type DrawFunc func(dst *image.RGBA, svgp svg.SvgPath, target svg.Matrix2D)
+
+// Tile is a tile of a pattern, rendered to paint a path. It
+// implements the Pattern interface of gg.
+type Tile struct {
+	img     *image.RGBA
+	tile    svg.Bounds
+	device  svg.Matrix2D // from device space to pattern space
+	opacity float64
+}
+
+// NewTile renders a tile of the pattern p, used to paint svgp in the device
+// space given by target. The content of the pattern is drawn with draw. It
+// returns nil if the tile is empty, in which case nothing is painted.
+func NewTile(p *svg.TilePattern, svgp *svg.SvgPath, target svg.Matrix2D, opacity float64, draw DrawFunc) *Tile {
+	tile, content := p.Tile(svgp.Path.Bounds())
+	if !(tile.W > 0 && tile.H > 0) {
+		return nil
+	}
+	// the tile is rendered at the resolution of the device
+	m := target.Mult(svgp.Style.Transform).Mult(p.Matrix)
+	w := tileSize(math.Hypot(m.A, m.B) * tile.W)
+	h := tileSize(math.Hypot(m.C, m.D) * tile.H)
+	sx, sy := float64(w)/tile.W, float64(h)/tile.H
+	toImage := svg.Matrix2D{A: sx, D: sy, E: -tile.X * sx, F: -tile.Y * sy}.Mult(content)
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for _, cp := range p.SvgPaths {
+		draw(img, cp, toImage)
+	}
+	return &Tile{img: img, tile: tile, device: m.Invert(), opacity: opacity}
+}
+
+// tileSize returns the number of pixels used for a tile length
+func tileSize(length float64) int {
+	n := int(math.Ceil(length))
+	if n < 1 {
+		return 1
+	}
+	if n > maxTileSize {
+		return maxTileSize
+	}
+	return n
+}
+
+// ColorAt returns the color of the pattern at the given device pixel.
+func (t *Tile) ColorAt(x, y int) color.Color {
+	px, py := t.device.Transform(float64(x)+0.5, float64(y)+0.5)
+	u := wrap((px-t.tile.X)/t.tile.W) * float64(t.img.Rect.Dx())
+	v := wrap((py-t.tile.Y)/t.tile.H) * float64(t.img.Rect.Dy())
+	c := t.img.RGBAAt(clampPixel(u, 0, t.img.Rect.Dx()), clampPixel(v, 0, t.img.Rect.Dy()))
+	if t.opacity >= 1 {
+		return c
+	}
+	return color.RGBA{
+		R: uint8(float64(c.R) * t.opacity),
+		G: uint8(float64(c.G) * t.opacity),
+		B: uint8(float64(c.B) * t.opacity),
+		A: uint8(float64(c.A) * t.opacity),
+	}
+}
+
+// wrap returns the fractional part of f, in [0, 1)
+func wrap(f float64) float64 {
+	return f - math.Floor(f)
+}
@@ -1,6 +1,9 @@
 package rasterx
 
 import (
+	"image"
+	"image/color"
+
 	"github.com/lafriks/go-svg"
 	"github.com/lafriks/go-svg/renderer"
 
@@ -11,12 +14,19 @@ import (
 // Draw the parsed SVG into the graphic context with the specified options.
 func Draw(gc *rasterx.Dasher, s *svg.Svg, opts ...renderer.RenderOption) {
 	opt := renderer.Options(s, opts...)
-	for _, svgp := range s.SvgPaths {
-		drawTransformed(gc, svgp, opt)
+	images := s.Images
+	for i, svgp := range s.SvgPaths {
+		for ; len(images) > 0 && images[0].Index <= i; images = images[1:] {
+			drawImage(gc, s, &images[0], opt)
+		}
+		drawTransformed(gc, s, svgp, opt)
+	}
+	for i := range images {
+		drawImage(gc, s, &images[i], opt)
 	}
 }
 
-func drawToStroker(gc *rasterx.Stroker, op svg.Operation, m svg.Matrix2D) {
+func drawToStroker(gc *rasterx.Dasher, op svg.Operation, m svg.Matrix2D) {
 	switch op := op.(type) {
 	case svg.OpMoveTo:
 		gc.Stop(false)
@@ -127,10 +137,43 @@ func toRasterxGradient(grad svg.Gradient) rasterx.Gradient {
 	}
 }
 
+// extentRect returns the pixels covered by the path extent
+func extentRect(extent fixed.Rectangle26_6) image.Rectangle {
+	return image.Rect(extent.Min.X.Floor(), extent.Min.Y.Floor(), extent.Max.X.Ceil()+1, extent.Max.Y.Ceil()+1)
+}
+
+// clipColor restricts the color, or color function, clr to the mask
+func clipColor(clr interface{}, mask *image.Alpha) interface{} {
+	var colorAt rasterx.ColorFunc
+	switch c := clr.(type) {
+	case color.Color:
+		colorAt = func(x, y int) color.Color { return c }
+	case rasterx.ColorFunc:
+		colorAt = c
+	default:
+		return clr
+	}
+	return rasterx.ColorFunc(func(x, y int) color.Color {
+		a := uint32(mask.AlphaAt(x, y).A)
+		r, g, b, ca := colorAt(x, y).RGBA()
+		return color.RGBA64{uint16(r * a / 255), uint16(g * a / 255), uint16(b * a / 255), uint16(ca * a / 255)}
+	})
+}
+
 // drawTransformed draws the compiled SvgPath into the driver while applying transform t.
-func drawTransformed(gc *rasterx.Dasher, svgp svg.SvgPath, opt *renderer.RenderOptions) {
-	m := svgp.Style.Transform.Mult(opt.Target)
+func drawTransformed(gc *rasterx.Dasher, s *svg.Svg, svgp svg.SvgPath, opt *renderer.RenderOptions) {
+	m := opt.Target.Mult(svgp.Style.Transform)
+	if svgp.Style.PaintOrder.StrokeFirst() {
+		drawStroke(gc, s, svgp, m, opt)
+		drawFill(gc, s, svgp, m, opt)
+	} else {
+		drawFill(gc, s, svgp, m, opt)
+		drawStroke(gc, s, svgp, m, opt)
+	}
+}
 
+// drawFill fills the path, transformed by m, if it has a fill paint.
+func drawFill(gc *rasterx.Dasher, s *svg.Svg, svgp svg.SvgPath, m svg.Matrix2D, opt *renderer.RenderOptions) {
 	if svgp.Style.FillerColor != nil {
 		filler := &gc.Filler
 		filler.Clear()
@@ -141,40 +184,102 @@ func drawTransformed(gc *rasterx.Dasher, svgp svg.SvgPath, opt *renderer.RenderO
 		}
 		filler.Stop(false)
 
+		var clr interface{}
 		switch color := svgp.Style.FillerColor.(type) {
 		case svg.PlainColor:
-			filler.SetColor(rasterx.ApplyOpacity(color, svgp.Style.FillOpacity*opt.Opacity))
+			clr = rasterx.ApplyOpacity(color, svgp.Style.FillOpacity*opt.Opacity)
 		case svg.Gradient:
 			_ = color.ApplyPathExtent(filler.GetPathExtent())
 			g := toRasterxGradient(color)
-			filler.SetColor(g.GetColorFunction(svgp.Style.FillOpacity * opt.Opacity))
+			clr = g.GetColorFunction(svgp.Style.FillOpacity * opt.Opacity)
+		case *svg.TilePattern:
+			if tile := renderer.NewTile(color, &svgp, opt.Target, svgp.Style.FillOpacity*opt.Opacity, drawTile(s)); tile != nil {
+				clr = rasterx.ColorFunc(tile.ColorAt)
+			}
+		case *svg.MeshGradient:
+			mesh := renderer.NewMesh(color, &svgp, opt.Target, extentRect(filler.GetPathExtent()), svgp.Style.FillOpacity*opt.Opacity)
+			clr = rasterx.ColorFunc(mesh.ColorAt)
+		}
+		if mask := renderer.ClipMask(s, &svgp.Style, opt.Target, extentRect(filler.GetPathExtent())); mask != nil {
+			clr = clipColor(clr, mask)
+		}
+		if clr != nil {
+			filler.SetColor(clr)
+			filler.Draw()
 		}
-		filler.Draw()
 	}
+}
+
+// drawStroke strokes the path, transformed by m, if it has a stroke paint.
+func drawStroke(gc *rasterx.Dasher, s *svg.Svg, svgp svg.SvgPath, m svg.Matrix2D, opt *renderer.RenderOptions) {
 	if svgp.Style.LinerColor != nil {
-		stroker := &gc.Stroker
+		stroker := gc
 		stroker.Clear()
+		dash, offset := svgp.Style.DeviceDash(m)
 		stroker.SetStroke(
-			fixed.Int26_6(svgp.Style.LineWidth*64*m.LineWidthScale()),
+			fixed.Int26_6(svgp.Style.DeviceLineWidth(m)*64),
 			svgp.Style.Join.MiterLimit,
 			toLineCap(svgp.Style.Join.LeadLineCap, toLineCap(svgp.Style.Join.TrailLineCap, rasterx.ButtCap)),
 			toLineCap(svgp.Style.Join.TrailLineCap, rasterx.ButtCap),
 			toLineGap(svgp.Style.Join.LineGap),
-			toLineJoin(svgp.Style.Join.LineJoin))
+			toLineJoin(svgp.Style.Join.LineJoin),
+			dash, offset)
 
 		for _, op := range svgp.Path {
 			drawToStroker(stroker, op, m)
 		}
 		stroker.Stop(false)
 
+		var clr interface{}
 		switch color := svgp.Style.LinerColor.(type) {
 		case svg.PlainColor:
-			stroker.SetColor(rasterx.ApplyOpacity(color, svgp.Style.LineOpacity*opt.Opacity))
+			clr = rasterx.ApplyOpacity(color, svgp.Style.LineOpacity*opt.Opacity)
 		case svg.Gradient:
 			_ = color.ApplyPathExtent(stroker.GetPathExtent())
 			g := toRasterxGradient(color)
-			stroker.SetColor(g.GetColorFunction(svgp.Style.LineOpacity * opt.Opacity))
+			clr = g.GetColorFunction(svgp.Style.LineOpacity * opt.Opacity)
+		case *svg.TilePattern:
+			if tile := renderer.NewTile(color, &svgp, opt.Target, svgp.Style.LineOpacity*opt.Opacity, drawTile(s)); tile != nil {
+				clr = rasterx.ColorFunc(tile.ColorAt)
+			}
+		case *svg.MeshGradient:
+			mesh := renderer.NewMesh(color, &svgp, opt.Target, extentRect(stroker.GetPathExtent()), svgp.Style.LineOpacity*opt.Opacity)
+			clr = rasterx.ColorFunc(mesh.ColorAt)
+		}
+		if mask := renderer.ClipMask(s, &svgp.Style, opt.Target, extentRect(stroker.GetPathExtent())); mask != nil {
+			clr = clipColor(clr, mask)
 		}
-		stroker.Draw()
+		if clr != nil {
+			stroker.SetColor(clr)
+			stroker.Draw()
+		}
+	}
+}
+
+// drawTile returns the function drawing the content of pattern tiles
+func drawTile(s *svg.Svg) renderer.DrawFunc {
+	return func(dst *image.RGBA, svgp svg.SvgPath, target svg.Matrix2D) {
+		w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+		scanner := rasterx.NewScannerGV(w, h, dst, dst.Bounds())
+		drawTransformed(rasterx.NewDasher(w, h, scanner), s, svgp, &renderer.RenderOptions{Opacity: 1, Target: target})
+	}
+}
+
+// drawImage draws the image element into the driver.
+func drawImage(gc *rasterx.Dasher, s *svg.Svg, img *svg.SvgImage, opt *renderer.RenderOptions) {
+	m := opt.Target.Mult(img.Style.Transform)
+	filler := &gc.Filler
+	filler.Clear()
+	filler.SetWinding(true)
+	for _, op := range img.Path() {
+		drawToFiller(filler, op, m)
+	}
+	filler.Stop(false)
+
+	var clr interface{} = rasterx.ColorFunc(renderer.NewImage(img, opt.Target, img.Style.Opacity*opt.Opacity).ColorAt)
+	if mask := renderer.ClipMask(s, &img.Style, opt.Target, extentRect(filler.GetPathExtent())); mask != nil {
+		clr = clipColor(clr, mask)
 	}
+	filler.SetColor(clr)
+	filler.Draw()
 }
@@ -0,0 +1,142 @@
+package rasterx
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/lafriks/go-svg"
+	"github.com/lafriks/go-svg/renderer"
+
+	"github.com/srwiley/rasterx"
+)
+
+// render draws the document into a w x h image
+func render(t *testing.T, src string, w, h int, opts ...svg.ParseOption) *image.RGBA {
+	s, err := svg.Parse(strings.NewReader(src), svg.StrictErrorMode, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	scanner := rasterx.NewScannerGV(w, h, img, img.Bounds())
+	Draw(rasterx.NewDasher(w, h, scanner), s, renderer.Target(0, 0, float64(w), float64(h)))
+	return img
+}
+
+// probe is the expected color of a pixel
+type probe struct {
+	x, y int
+	c    color.RGBA
+}
+
+var (
+	red   = color.RGBA{R: 0xff, A: 0xff}
+	blue  = color.RGBA{B: 0xff, A: 0xff}
+	clear = color.RGBA{}
+)
+
+// checkProbes reports the pixels whose color is not close to the expected one
+func checkProbes(t *testing.T, img *image.RGBA, probes []probe) {
+	t.Helper()
+	near := func(a, b uint8) bool { return int(a)-int(b) < 8 && int(b)-int(a) < 8 }
+	for _, p := range probes {
+		c := img.RGBAAt(p.x, p.y)
+		if !near(c.R, p.c.R) || !near(c.G, p.c.G) || !near(c.B, p.c.B) || !near(c.A, p.c.A) {
+			t.Errorf("pixel (%d, %d): expected %v, got %v", p.x, p.y, p.c, c)
+		}
+	}
+}
+
+func TestClipPath(t *testing.T) {
+	img := render(t, `<svg viewBox="0 0 40 20">
+		<clipPath id="left"><rect width="10" height="20"/></clipPath>
+		<clipPath id="ring"><path d="M20 0 H40 V20 H20 Z M25 5 H35 V15 H25 Z" clip-rule="evenodd"/></clipPath>
+		<rect width="20" height="20" fill="red" clip-path="url(#left)"/>
+		<rect x="20" width="20" height="20" fill="red" clip-path="url(#ring)"/>
+	</svg>`, 40, 20)
+	checkProbes(t, img, []probe{
+		{5, 10, red}, {15, 10, clear}, // clipped to the left half
+		{22, 2, red}, {30, 10, clear}, // even-odd hole
+	})
+}
+
+func TestPattern(t *testing.T) {
+	img := render(t, `<svg viewBox="0 0 40 20">
+		<pattern id="p" width="10" height="10" patternUnits="userSpaceOnUse">
+			<rect width="5" height="10" fill="red"/><rect x="5" width="5" height="10" fill="blue"/>
+		</pattern>
+		<rect width="20" height="20" fill="url(#p)"/>
+		<rect x="22" y="2" width="16" height="16" fill="none" stroke="url(#p)" stroke-width="4"/>
+	</svg>`, 40, 20)
+	checkProbes(t, img, []probe{
+		{2, 2, red}, {7, 2, blue}, {12, 12, red}, {17, 5, blue}, // tiled fill
+		{22, 10, red}, {36, 10, blue}, {30, 10, clear}, // tiled stroke
+	})
+}
+
+func TestImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.SetRGBA(0, 0, red)
+	src.SetRGBA(1, 0, blue)
+	var data bytes.Buffer
+	if err := png.Encode(&data, src); err != nil {
+		t.Fatal(err)
+	}
+	img := render(t, `<svg viewBox="0 0 20 20">
+		<image href="data:image/png;base64,`+base64.StdEncoding.EncodeToString(data.Bytes())+`"
+			width="20" height="10" preserveAspectRatio="none"/>
+	</svg>`, 20, 20)
+	checkProbes(t, img, []probe{{2, 5, red}, {17, 5, blue}, {5, 15, clear}})
+}
+
+func TestMeshGradient(t *testing.T) {
+	img := render(t, `<svg viewBox="0 0 40 20">
+		<meshgradient id="m" x="0" y="0" gradientUnits="userSpaceOnUse">
+			<meshrow><meshpatch>
+				<stop path="c 13,0 27,0 40,0" stop-color="red"/>
+				<stop path="c 0,7 0,13 0,20" stop-color="red"/>
+				<stop path="c -13,0 -27,0 -40,0" stop-color="blue"/>
+				<stop path="c 0,-7 0,-13 0,-20" stop-color="blue"/>
+			</meshpatch></meshrow>
+		</meshgradient>
+		<rect width="20" height="20" fill="url(#m)"/>
+		<path d="M30 0 V20" fill="none" stroke="url(#m)" stroke-width="4"/>
+	</svg>`, 40, 20)
+	checkProbes(t, img, []probe{
+		// shaded from red at the top to blue at the bottom
+		{10, 0, color.RGBA{R: 249, B: 6, A: 0xff}},
+		{10, 10, color.RGBA{R: 121, B: 134, A: 0xff}},
+		{10, 19, color.RGBA{R: 6, B: 249, A: 0xff}},
+		{30, 10, color.RGBA{R: 121, B: 134, A: 0xff}}, {36, 10, clear},
+	})
+}
+
+func TestPaintOrder(t *testing.T) {
+	img := render(t, `<svg viewBox="0 0 40 20">
+		<rect x="5" y="5" width="10" height="10" fill="red" stroke="blue" stroke-width="6"/>
+		<rect x="25" y="5" width="10" height="10" fill="red" stroke="blue" stroke-width="6" paint-order="stroke"/>
+	</svg>`, 40, 20)
+	checkProbes(t, img, []probe{
+		{3, 10, blue}, {6, 10, blue}, {10, 10, red}, // stroke above the fill
+		{23, 10, blue}, {26, 10, red}, {30, 10, red}, // fill above the stroke
+	})
+}
+
+func TestNonScalingStroke(t *testing.T) {
+	// drawn at twice the size of the view box
+	img := render(t, `<svg viewBox="0 0 40 20">
+		<path d="M0 5 H40" stroke="blue" stroke-width="2" stroke-dasharray="5 5"/>
+		<path d="M0 15 H40" stroke="blue" stroke-width="2" stroke-dasharray="5 5" vector-effect="non-scaling-stroke"/>
+	</svg>`, 80, 40)
+	checkProbes(t, img, []probe{
+		// 4 pixels wide, with dashes of 10 pixels
+		{5, 8, blue}, {5, 11, blue}, {15, 10, clear}, {25, 10, blue},
+		// 2 pixels wide, with dashes of 5 pixels
+		{2, 27, clear}, {2, 29, blue}, {2, 30, blue}, {2, 32, clear},
+		{7, 30, clear}, {12, 30, blue},
+	})
+}
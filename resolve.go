@@ -0,0 +1,174 @@
+package svg
+
+// This file implements the resolution of references to other documents,
+// such as <use href="icons.svg#gear">.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// DefaultResolveDepth is the default limit of nested references to other documents.
+const DefaultResolveDepth = 8
+
+// Resolver gives access to the resources referenced by a document,
+// such as images and other SVG documents.
+type Resolver interface {
+	// Open opens the named resource. Names are either URLs, or slash
+	// separated paths resolved against the name of the referencing document.
+	Open(name string) (io.ReadCloser, error)
+}
+
+type fsResolver struct {
+	fsys fs.FS
+}
+
+func (r fsResolver) Open(name string) (io.ReadCloser, error) {
+	return r.fsys.Open(name)
+}
+
+// FSResolver returns a Resolver reading the resources from fsys.
+func FSResolver(fsys fs.FS) Resolver {
+	return fsResolver{fsys: fsys}
+}
+
+type (
+	// resolution is the state of the resolution of references, shared
+	// by a document and the documents it references
+	resolution struct {
+		resolver Resolver
+		maxDepth int
+		docs     map[string]*document
+		stack    []reference // references being resolved
+	}
+
+	// reference is a reference being resolved
+	reference struct {
+		ref      string
+		external bool // to an other document than the referencing one
+	}
+
+	// document is a referenced document
+	document struct {
+		data   []byte
+		svg    *Svg       // parsed when a paint server is referenced
+		tokens *tokenized // read when an element is referenced
+		err    error
+	}
+)
+
+func newResolution(r Resolver, maxDepth int) *resolution {
+	return &resolution{resolver: r, maxDepth: maxDepth, docs: make(map[string]*document)}
+}
+
+// push marks the reference as being resolved, failing if it is already,
+// or if too many references to other documents are nested. References
+// within a document are only checked for cycles.
+func (r *resolution) push(ref string, external bool) error {
+	depth := 0
+	for _, s := range r.stack {
+		if s.ref == ref {
+			return fmt.Errorf("cyclic reference to %s", ref)
+		}
+		if s.external {
+			depth++
+		}
+	}
+	if external && depth >= r.maxDepth {
+		return fmt.Errorf("cannot resolve %s: more than %d nested references to other documents", ref, r.maxDepth)
+	}
+	r.stack = append(r.stack, reference{ref: ref, external: external})
+	return nil
+}
+
+func (r *resolution) pop() {
+	r.stack = r.stack[:len(r.stack)-1]
+}
+
+// splitRef returns the name of the document holding the referenced
+// element, and the id of this element
+func (c *svgCursor) splitRef(ref string) (doc, id string) {
+	file, id, _ := strings.Cut(strings.TrimSpace(ref), "#")
+	switch {
+	case file == "":
+		return c.base, id
+	case strings.Contains(file, ":"):
+		// an URL
+		return file, id
+	case strings.HasPrefix(file, "/"):
+		return path.Clean(file[1:]), id
+	default:
+		return path.Join(path.Dir(c.base), file), id
+	}
+}
+
+// readResource returns the content of the named resource
+func (c *svgCursor) readResource(name string) ([]byte, error) {
+	if c.res.resolver == nil {
+		return nil, fmt.Errorf("cannot load %s: no resolver", name)
+	}
+	doc, ok := c.res.docs[name]
+	if !ok {
+		doc = &document{}
+		var f io.ReadCloser
+		if f, doc.err = c.res.resolver.Open(name); doc.err == nil {
+			doc.data, doc.err = io.ReadAll(f)
+			f.Close()
+		}
+		c.res.docs[name] = doc
+	}
+	return doc.data, doc.err
+}
+
+// document returns the parsed document holding the elements
+// referenced by ref, and their id. It returns nil if the document
+// cannot be loaded, after handling the error.
+func (c *svgCursor) document(ref string) (*Svg, string, error) {
+	name, id := c.splitRef(ref)
+	if name == c.name {
+		return c.svg, id, nil
+	}
+	data, err := c.readResource(name)
+	if err != nil {
+		return nil, id, c.handleError("%s", err)
+	}
+	doc := c.res.docs[name]
+	if doc.svg == nil {
+		if err = c.res.push(name, true); err != nil {
+			return nil, id, c.handleError("%s", err)
+		}
+		o := c.options
+		o.name = name
+		doc.svg, err = parse(bytes.NewReader(data), c.errorMode, o)
+		c.res.pop()
+		if err != nil {
+			doc.svg = nil
+			return nil, id, c.handleError("cannot parse %s: %s", name, err)
+		}
+	}
+	return doc.svg, id, nil
+}
+
+// tokens returns the content of the named document, which is either
+// the one being parsed or one loaded through the resolver
+func (c *svgCursor) tokens(name string) (*tokenized, error) {
+	if name == c.name {
+		return c.svg.doc, nil
+	}
+	data, err := c.readResource(name)
+	if err != nil {
+		return nil, err
+	}
+	doc := c.res.docs[name]
+	if doc.tokens == nil {
+		if doc.tokens, err = tokenize(bytes.NewReader(data)); err != nil {
+			doc.tokens = nil
+			return nil, fmt.Errorf("cannot parse %s: %s", name, err)
+		}
+	}
+	return doc.tokens, nil
+}
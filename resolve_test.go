@@ -0,0 +1,109 @@
+package svg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestResolver(t *testing.T) {
+	var tex bytes.Buffer
+	if err := png.Encode(&tex, image.NewGray(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"main.svg": {Data: []byte(`<svg viewBox="0 0 100 100">
+			<use href="icons/set.svg#gear" x="10"/>
+			<rect width="10" height="10" fill="url(icons/set.svg#red)"/>
+			<image href="textures/wood.png"/>
+		</svg>`)},
+		"icons/set.svg": {Data: []byte(`<svg>
+			<linearGradient id="red"><stop stop-color="red"/></linearGradient>
+			<g id="gear" fill="url(#red)">
+				<rect width="5" height="5"/>
+				<use href="../main.svg#missing"/>
+			</g>
+		</svg>`)},
+		"textures/wood.png": {Data: tex.Bytes()},
+	}
+	s, err := ParseFS(fsys, "main.svg", WarnErrorMode, Resources(FSResolver(fsys)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SvgPaths) != 2 || len(s.Images) != 1 {
+		t.Fatalf("expected 2 paths and 1 image, got %d and %d", len(s.SvgPaths), len(s.Images))
+	}
+	for _, p := range s.SvgPaths {
+		if _, ok := p.Style.FillerColor.(Gradient); !ok {
+			t.Errorf("expected a gradient fill, got %v", p.Style.FillerColor)
+		}
+	}
+	if x, _ := s.SvgPaths[0].Style.Transform.Transform(0, 0); s.SvgPaths[0].Path[0].(OpMoveTo).X != 0 || x != 10 {
+		t.Errorf("unexpected path %v", s.SvgPaths[0].Path)
+	}
+	if size := s.Images[0].Image.Bounds(); size.Dx() != 3 || size.Dy() != 2 {
+		t.Errorf("unexpected image size %v", size)
+	}
+
+	// without resolver, external references fail
+	if _, err = Parse(bytes.NewReader(fsys["main.svg"].Data), StrictErrorMode); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err = ParseFS(fsys, "main.svg", StrictErrorMode); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err = ParseFS(fsys, "main.svg", StrictErrorMode, Resources(FSResolver(fstest.MapFS{}))); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestResolverCycles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.svg": {Data: []byte(`<svg><g id="a"><use href="b.svg#b"/></g></svg>`)},
+		"b.svg": {Data: []byte(`<svg><g id="b"><use href="a.svg#a"/></g></svg>`)},
+		"local.svg": {Data: []byte(`<svg><defs><g id="loop"><use href="#loop"/></g></defs>
+			<use href="#loop"/></svg>`)},
+		"paint.svg": {Data: []byte(`<svg><rect width="1" height="1" fill="url(other.svg#g)"/></svg>`)},
+		"other.svg": {Data: []byte(`<svg><rect width="1" height="1" fill="url(paint.svg#h)"/>
+			<linearGradient id="g"><stop stop-color="red"/></linearGradient></svg>`)},
+	}
+	for _, name := range []string{"a.svg", "local.svg"} {
+		if _, err := ParseFS(fsys, name, StrictErrorMode, Resources(FSResolver(fsys))); err == nil || !strings.Contains(err.Error(), "cyclic reference") {
+			t.Errorf("%s: expected a cyclic reference, got %v", name, err)
+		}
+	}
+	// the documents referencing each other for paint servers are parsed once
+	s, err := ParseFS(fsys, "paint.svg", WarnErrorMode, Resources(FSResolver(fsys)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.SvgPaths[0].Style.FillerColor.(Gradient); !ok {
+		t.Errorf("expected a gradient fill, got %v", s.SvgPaths[0].Style.FillerColor)
+	}
+
+	// the depth of references to other documents is limited
+	deep := fstest.MapFS{
+		"a.svg": {Data: []byte(`<svg><use href="b.svg#b"/></svg>`)},
+		"b.svg": {Data: []byte(`<svg><g id="b"><use href="c.svg#c"/></g></svg>`)},
+		"c.svg": {Data: []byte(`<svg><rect id="c" width="1" height="1"/></svg>`)},
+	}
+	if _, err = ParseFS(deep, "a.svg", StrictErrorMode, Resources(FSResolver(deep)), ResolveDepth(2)); err != nil {
+		t.Error(err)
+	}
+	if _, err = ParseFS(deep, "a.svg", StrictErrorMode, Resources(FSResolver(deep)), ResolveDepth(1)); err == nil {
+		t.Error("expected an error")
+	}
+	// while references within a document are not
+	local := `<svg><defs><rect id="r0" width="1" height="1"/>`
+	for i := 1; i <= 2*DefaultResolveDepth; i++ {
+		local += fmt.Sprintf(`<g id="r%d"><use href="#r%d"/></g>`, i, i-1)
+	}
+	local += fmt.Sprintf(`</defs><use href="#r%d"/></svg>`, 2*DefaultResolveDepth)
+	if s, err = Parse(strings.NewReader(local), IgnoreErrorMode); err != nil || len(s.SvgPaths) != 1 {
+		t.Errorf("expected the nested rect, got %v", err)
+	}
+}
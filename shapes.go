@@ -204,6 +204,35 @@ func (p *Path) addArc(points []float64, cx, cy, px, py float64) (lx, ly float64)
 	return lx, ly
 }
 
+// quadPointAt gives points for parameterized quadratic bezier curve; p0, p1, p2 control points, t parameter
+func quadPointAt(x0, y0, x1, y1, x2, y2, t float64) (px, py float64) {
+	u := 1 - t
+	px = u*u*x0 + 2*u*t*x1 + t*t*x2
+	py = u*u*y0 + 2*u*t*y1 + t*t*y2
+	return
+}
+
+// cubicPointAt gives points for parameterized cubic bezier curve; p0, p1, p2, p3 control points, t parameter
+func cubicPointAt(x0, y0, x1, y1, x2, y2, x3, y3, t float64) (px, py float64) {
+	u := 1 - t
+	px = u*u*u*x0 + 3*u*u*t*x1 + 3*u*t*t*x2 + t*t*t*x3
+	py = u*u*u*y0 + 3*u*u*t*y1 + 3*u*t*t*y2 + t*t*t*y3
+	return
+}
+
+// flatteningSteps returns the number of line segments used to
+// approximate a curve whose control polygon has the given length
+func flatteningSteps(ctrlLength float64) int {
+	n := int(ctrlLength)
+	if n < 8 {
+		return 8
+	}
+	if n > 128 {
+		return 128
+	}
+	return n
+}
+
 // ellipsePrime gives tangent vectors for parameterized elipse; a, b, radii, eta parameter, center cx, cy
 func ellipsePrime(a, b, sinTheta, cosTheta, eta, cx, cy float64) (px, py float64) {
 	bCosEta := b * math.Cos(eta)
@@ -7,26 +7,71 @@ import (
 	"encoding/xml"
 	"errors"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 
+	"golang.org/x/image/font/sfnt"
 	"golang.org/x/net/html/charset"
 )
 
+// SvgNamespace is the namespace of SVG elements. Elements without
+// namespace are considered as part of it.
+const SvgNamespace = "http://www.w3.org/2000/svg"
+
 // PathStyle holds the state of the SVG style
 type PathStyle struct {
+	Opacity                  float64 // opacity of the element and its ancestors
 	FillOpacity, LineOpacity float64
 	LineWidth                float64
+	NonScalingStroke         bool // vector-effect="non-scaling-stroke", which is not inherited
 	UseNonZeroWinding        bool
 
 	Join                    JoinOptions
 	Dash                    DashOptions
+	Font                    FontOptions
+	Text                    TextOptions
 	FillerColor, LinerColor Pattern // either PlainColor or Gradient
 
-	Masks []string
+	Masks              []string
+	ClipPaths          []*ClipRef // clip paths of the element and its ancestors
+	ClipNonZeroWinding bool       // clip-rule, used by the paths of a clip path
+
+	MarkerStart, MarkerMid, MarkerEnd string     // ids of the markers drawn on the vertices
+	PaintOrder                        PaintOrder // order of the fill, the stroke and the markers
+
+	Link *Link // innermost a element containing the element, if any
+
+	displayNone bool // display="none", which is not inherited
+	invisible   bool // visibility="hidden" or "collapse"
 
 	Transform Matrix2D // current transform
 }
 
+// DeviceLineWidth returns the width of the stroke once the path is
+// transformed by m, the transform from user space to device space.
+// Non-scaling strokes keep their width in device space.
+func (s *PathStyle) DeviceLineWidth(m Matrix2D) float64 {
+	if s.NonScalingStroke {
+		return s.LineWidth
+	}
+	return s.LineWidth * m.LineWidthScale()
+}
+
+// DeviceDash returns the dash array and the dash offset of the stroke once
+// the path is transformed by m, scaled as its width by DeviceLineWidth.
+func (s *PathStyle) DeviceDash(m Matrix2D) ([]float64, float64) {
+	if s.NonScalingStroke || len(s.Dash.Dash) == 0 {
+		return s.Dash.Dash, s.Dash.DashOffset
+	}
+	scale := m.LineWidthScale()
+	dash := make([]float64, len(s.Dash.Dash))
+	for i, d := range s.Dash.Dash {
+		dash[i] = d * scale
+	}
+	return dash, s.Dash.DashOffset * scale
+}
+
 // SvgPath binds a style to a path
 type SvgPath struct {
 	Path  Path
@@ -41,109 +86,308 @@ type Bounds struct{ X, Y, W, H float64 }
 // See the `Draw` methods to use it.
 type Svg struct {
 	ViewBox      Bounds
-	Titles       []string // Title elements collect here
-	Descriptions []string // Description elements collect here
+	AspectRatio  AspectRatio // preserveAspectRatio of the root element
+	Titles       []string    // Title elements collect here
+	Descriptions []string    // Description elements collect here
 	SvgPaths     []SvgPath
+	Images       []SvgImage // drawn in order with SvgPaths, see SvgImage.Index
 	Transform    Matrix2D
 	SvgMasks     map[string]*SvgMask
+	ClipPaths    map[string]*SvgClipPath // including the viewports of nested svg elements and markers
+	Views        map[string]SvgView
+	Animations   []*Animation // timeline of the animation elements, see At
 
 	Width, Height string // top level width and height attributes
 
-	grads map[string]*Gradient
-	defs  map[string][]definition
+	grads    map[string]*Gradient
+	patterns map[string]*TilePattern
+	meshes   map[string]*MeshGradient
+	texts    []TextRun
+	doc      *tokenized // referenced by use elements
+	static   *tokenized // document of the animations, if the image is a snapshot
+
+	// used to instantiate symbols
+	errorMode ErrorMode
+	options   parseOptions
 }
 
 // Parse reads the Icon from the given io.Reader
 // This only supports a sub-set of SVG, but
 // is enough to draw many svgs. errMode determines if the svg ignores, errors out, or logs a warning
 // if it does not handle an element found in the svg file.
-func Parse(stream io.Reader, errMode ErrorMode) (*Svg, error) {
+func Parse(stream io.Reader, errMode ErrorMode, opts ...ParseOption) (*Svg, error) {
+	return parse(stream, errMode, newParseOptions(parseOptions{}, opts))
+}
+
+// newSvgCursor returns a cursor drawing into svg
+func newSvgCursor(svg *Svg, errMode ErrorMode, o parseOptions) *svgCursor {
+	svg.errorMode, svg.options = errMode, o
+	c := &svgCursor{styleStack: []PathStyle{DefaultStyle}, svg: svg}
+	c.errorMode = errMode
+	c.fonts = o.fonts
+	c.options = o
+	c.name, c.base = o.name, o.name
+	c.res = o.res
+	c.embeddedFonts = NewFontCollection()
+	c.fontCache = make(map[fontKey]*sfnt.Font)
+	return c
+}
+
+func parse(stream io.Reader, errMode ErrorMode, o parseOptions) (*Svg, error) {
+	if o.res == nil {
+		o.res = newResolution(o.resolver, o.resolveDepth)
+	}
+	doc, readErr := tokenize(stream)
+	if doc == nil {
+		return nil, readErr
+	}
+	svg, err := parseTokens(doc, errMode, o)
+	if err != nil {
+		return svg, err
+	}
+	if readErr != nil {
+		return svg, readErr
+	}
+	c := newSvgCursor(svg, errMode, o)
+	if err := c.readAnimations(); err != nil {
+		return svg, err
+	}
+	return svg, c.readCSSAnimations()
+}
+
+// parseTokens builds the image described by the tokens of doc
+func parseTokens(doc *tokenized, errMode ErrorMode, o parseOptions) (*Svg, error) {
 	svg := &Svg{
-		defs:      make(map[string][]definition),
 		grads:     make(map[string]*Gradient),
+		patterns:  make(map[string]*TilePattern),
+		meshes:    make(map[string]*MeshGradient),
 		SvgMasks:  make(map[string]*SvgMask),
+		ClipPaths: make(map[string]*SvgClipPath),
+		Views:     make(map[string]SvgView),
 		Transform: Identity,
+		doc:       doc,
 	}
-	svgCursor := &svgCursor{styleStack: []PathStyle{DefaultStyle}, svg: svg}
-	svgCursor.errorMode = errMode
+	svgCursor := newSvgCursor(svg, errMode, o)
+	for _, t := range doc.tokens {
+		if err := svgCursor.readToken(t); err != nil {
+			return svg, err
+		}
+	}
+	return svg, svgCursor.resolvePaintServers()
+}
+
+// resolvePaintServers applies the href inheritance of gradients and
+// patterns, and the references to them, once the whole document is read
+func (c *svgCursor) resolvePaintServers() error {
+	if err := c.resolveGradients(); err != nil {
+		return err
+	}
+	if err := c.resolvePatterns(); err != nil {
+		return err
+	}
+	c.resolvePaints()
+	c.breakPatternCycles()
+	return nil
+}
+
+// readToken processes a token of the document
+func (c *svgCursor) readToken(t xml.Token) error {
+	// Inspect the type of the XML token
+	switch se := t.(type) {
+	case xml.StartElement:
+		if c.skipped > 0 || !c.evaluateConditions(se.Attr) {
+			c.skipped++
+			return nil
+		}
+		// unsupported elements are not candidates of switch elements
+		if skip, err := c.isUnsupported(se); skip {
+			c.skipped++
+			return err
+		}
+		if c.isSwitchedOff() {
+			c.skipped++
+			return nil
+		}
+		// Reads all recognized style attributes from the start element
+		// and places it on top of the styleStack
+		if err := c.pushStyle(se.Attr); err != nil {
+			return err
+		}
+		if c.styleStack[len(c.styleStack)-1].displayNone {
+			if c.clip != nil || c.pattern != nil || c.inMask || c.text != nil {
+				// not part of the content of a clip path, pattern, mask or text
+				c.styleStack = c.styleStack[:len(c.styleStack)-1]
+				c.skipped++
+				return nil
+			}
+			// the subtree is not drawn, but its paint servers,
+			// clip paths and markers may be referenced
+			c.hidden++
+		}
+		return c.readStartElement(se)
+	case xml.EndElement:
+		if c.skipped > 0 {
+			c.skipped--
+			return nil
+		}
+		// pop style
+		if c.styleStack[len(c.styleStack)-1].displayNone {
+			// after the end of the element, which was handled as hidden
+			defer func() { c.hidden-- }()
+		}
+		c.styleStack = c.styleStack[:len(c.styleStack)-1]
+		switch se.Name.Local {
+		case "mask":
+			if c.mask != nil {
+				c.svg.SvgMasks[c.mask.ID] = c.mask
+				c.mask = nil
+			}
+			c.inMask = false
+		case "clipPath":
+			c.endClipPath()
+		case "defs", "symbol", "marker":
+			c.hidden--
+		case "switch":
+			if n := len(c.switches); n > 0 && !c.isHidden("switch") {
+				c.switches = c.switches[:n-1]
+			}
+		case "svg":
+			if n := len(c.viewports); n > 0 && !c.isHidden("svg") {
+				c.viewports = c.viewports[:n-1]
+			}
+		case "pattern":
+			c.pattern = nil
+		case "text":
+			return c.endText()
+		case "tspan", "textPath":
+			c.popTextFrame()
+		case "style":
+			return c.readStylesheet()
+		case "title":
+			c.inTitleText = false
+		case "desc":
+			c.inDescText = false
+		case "radialGradient", "linearGradient":
+			c.inGrad = false
+		case "meshpatch":
+			return c.endMeshPatch()
+		case "meshgradient":
+			c.mesh = nil
+		}
+	case xml.CharData:
+		if c.skipped > 0 {
+			return nil
+		}
+		if c.inTitleText {
+			c.svg.Titles[len(c.svg.Titles)-1] += string(se)
+		}
+		if c.inDescText {
+			c.svg.Descriptions[len(c.svg.Descriptions)-1] += string(se)
+		}
+		if c.inStyle {
+			c.styleText.Write(se)
+		}
+		if c.text != nil && !c.inTitleText && !c.inDescText {
+			c.text.addChars(string(se), c.styleStack[len(c.styleStack)-1])
+		}
+	}
+	return nil
+}
+
+// tokenized is the content of a document, with the
+// position of the elements which have an id
+type tokenized struct {
+	tokens []xml.Token
+	ids    map[string]span
+}
+
+// span is the position of an element in the tokens of a
+// document, from its start to its end element
+type span struct{ start, end int }
+
+// tokenize reads the start, end and character data tokens of the
+// document. After a read error, the tokens read so far are returned
+// along with the error.
+func tokenize(stream io.Reader) (*tokenized, error) {
 	decoder := xml.NewDecoder(stream)
 	decoder.CharsetReader = charset.NewReaderLabel
+	doc := &tokenized{ids: make(map[string]span)}
+	var open []string // ids of the open elements, empty if not indexed
 	seenTag := false
 	for {
 		t, err := decoder.Token()
-		if err != nil {
-			if err == io.EOF {
-				if !seenTag {
-					return nil, errors.New("invalid svg xml svg")
-				}
-				break
+		if err == io.EOF {
+			if !seenTag {
+				return nil, errors.New("invalid svg xml svg")
 			}
-			return svg, err
+			return doc, nil
+		} else if err != nil {
+			return doc, err
 		}
-		// Inspect the type of the XML token
-		switch se := t.(type) {
+		switch t := t.(type) {
 		case xml.StartElement:
 			seenTag = true
-			// Reads all recognized style attributes from the start element
-			// and places it on top of the styleStack
-			err = svgCursor.pushStyle(se.Attr)
-			if err != nil {
-				return svg, err
+			id := ""
+			for _, attr := range t.Attr {
+				if _, seen := doc.ids[attr.Value]; attr.Name.Local == "id" && attr.Value != "" && !seen {
+					// the first element with an id is the one referenced
+					id = attr.Value
+				}
 			}
-			err = svgCursor.readStartElement(se)
-			if err != nil {
-				return svg, err
+			if id != "" {
+				doc.ids[id] = span{start: len(doc.tokens), end: -1}
 			}
+			open = append(open, id)
+			doc.tokens = append(doc.tokens, t.Copy())
 		case xml.EndElement:
-			// pop style
-			svgCursor.styleStack = svgCursor.styleStack[:len(svgCursor.styleStack)-1]
-			switch se.Name.Local {
-			case "g":
-				if svgCursor.inDefs {
-					svgCursor.currentDef = append(svgCursor.currentDef, definition{
-						Tag: "endg",
-					})
-				}
-			case "mask":
-				if svgCursor.mask != nil {
-					svgCursor.svg.SvgMasks[svgCursor.mask.ID] = svgCursor.mask
-					svgCursor.mask = nil
+			if n := len(open); n > 0 {
+				if id := open[n-1]; id != "" {
+					doc.ids[id] = span{start: doc.ids[id].start, end: len(doc.tokens)}
 				}
-				svgCursor.inMask = false
-			case "title":
-				svgCursor.inTitleText = false
-			case "desc":
-				svgCursor.inDescText = false
-			case "defs":
-				if len(svgCursor.currentDef) > 0 {
-					svgCursor.svg.defs[svgCursor.currentDef[0].ID] = svgCursor.currentDef
-					svgCursor.currentDef = make([]definition, 0)
-				}
-				svgCursor.inDefs = false
-			case "radialGradient", "linearGradient":
-				svgCursor.inGrad = false
+				open = open[:n-1]
 			}
+			doc.tokens = append(doc.tokens, t)
 		case xml.CharData:
-			if svgCursor.inTitleText {
-				svg.Titles[len(svg.Titles)-1] += string(se)
-			}
-			if svgCursor.inDescText {
-				svg.Descriptions[len(svg.Descriptions)-1] += string(se)
-			}
+			doc.tokens = append(doc.tokens, t.Copy())
 		}
 	}
-	return svg, nil
+}
+
+// lookup returns the tokens of the element with the given id
+// and of its descendants
+func (d *tokenized) lookup(id string) ([]xml.Token, bool) {
+	s, ok := d.ids[id]
+	if !ok || s.end < 0 {
+		return nil, false
+	}
+	return d.tokens[s.start : s.end+1], true
 }
 
 // ParseFile reads the SVG from the named file
 // This only supports a sub-set of SVG, but
 // is enough to draw many svgs. errMode determines if the svg ignores, errors out, or logs a warning
 // if it does not handle an element found in the svg file.
-func ParseFile(name string, errMode ErrorMode) (*Svg, error) {
+// The resources referenced by the file are only read with the Resources
+// option, such as Resources(FSResolver(os.DirFS(dir))) for the directory
+// of the file.
+func ParseFile(name string, errMode ErrorMode, opts ...ParseOption) (*Svg, error) {
 	fin, errf := os.Open(name)
 	if errf != nil {
 		return nil, errf
 	}
 	defer fin.Close()
-	return Parse(fin, errMode)
+	return parse(fin, errMode, newParseOptions(parseOptions{name: filepath.Base(name)}, opts))
+}
+
+// ParseFS reads the SVG from the named file of fsys. The resources it
+// references are only read with the Resources option, such as
+// Resources(FSResolver(fsys)), relatively to name.
+// See ParseFile.
+func ParseFS(fsys fs.FS, name string, errMode ErrorMode, opts ...ParseOption) (*Svg, error) {
+	fin, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fin.Close()
+	return parse(fin, errMode, newParseOptions(parseOptions{name: name}, opts))
 }
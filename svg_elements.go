@@ -3,7 +3,6 @@ package svg
 import (
 	"encoding/xml"
 	"errors"
-	"strings"
 
 	"golang.org/x/image/math/fixed"
 )
@@ -19,6 +18,7 @@ type svgFunc func(c *svgCursor, attrs []xml.Attr) error
 var drawFuncs = map[string]svgFunc{
 	"svg":            svgF,
 	"g":              gF,
+	"a":              aF,
 	"line":           lineF,
 	"stop":           stopF,
 	"rect":           rectF,
@@ -29,13 +29,30 @@ var drawFuncs = map[string]svgFunc{
 	"path":           pathF,
 	"desc":           descF,
 	"defs":           defsF,
+	"marker":         markerF,
 	"title":          titleF,
 	"linearGradient": linearGradientF,
 	"radialGradient": radialGradientF,
+	"meshgradient":   meshGradientF,
+	"meshrow":        meshRowF,
+	"meshpatch":      meshPatchF,
 	"mask":           maskF,
+	"text":           textF,
+	"tspan":          tspanF,
+	"textPath":       textPathF,
+	"style":          styleF,
+	"clipPath":       clipPathF,
+	"pattern":        patternF,
+	"image":          imageF,
+	"symbol":         symbolF,
+	"switch":         switchF,
+	"view":           viewF,
 }
 
 func svgF(c *svgCursor, attrs []xml.Attr) error {
+	if len(c.viewports) > 0 {
+		return nestedSvgF(c, attrs)
+	}
 	c.svg.ViewBox.X = 0
 	c.svg.ViewBox.Y = 0
 	c.svg.ViewBox.W = 0
@@ -59,6 +76,12 @@ func svgF(c *svgCursor, attrs []xml.Attr) error {
 		case "height":
 			c.svg.Height = attr.Value
 			height, err = parseBasicFloat(attr.Value)
+		case "preserveAspectRatio":
+			if c.svg.AspectRatio, err = parseAspectRatio(attr.Value); err != nil {
+				// the default xMidYMid meet applies
+				c.svg.AspectRatio = AspectRatio{}
+				err = c.handleError("%s", err)
+			}
 		}
 		if err != nil {
 			return err
@@ -70,6 +93,7 @@ func svgF(c *svgCursor, attrs []xml.Attr) error {
 	if c.svg.ViewBox.H == 0 {
 		c.svg.ViewBox.H = height
 	}
+	c.viewports = append(c.viewports, c.svg.ViewBox)
 	return nil
 }
 func gF(*svgCursor, []xml.Attr) error { return nil } // g does nothing but push the style
@@ -105,7 +129,7 @@ func rectF(c *svgCursor, attrs []xml.Attr) error {
 	if ry != 0 && rx == 0 {
 		rx = ry
 	}
-	c.path.addRoundRect(x+c.curX, y+c.curY, w+x+c.curX, h+y+c.curY, rx, ry, 0)
+	c.path.addRoundRect(x, y, w+x, h+y, rx, ry, 0)
 	return nil
 }
 
@@ -171,7 +195,7 @@ func circleF(c *svgCursor, attrs []xml.Attr) error {
 	if rx == 0 || ry == 0 { // not drawn, but not an error
 		return nil
 	}
-	c.ellipseAt(cx+c.curX, cy+c.curY, rx, ry)
+	c.ellipseAt(cx, cy, rx, ry)
 	return nil
 }
 
@@ -194,12 +218,12 @@ func lineF(c *svgCursor, attrs []xml.Attr) error {
 		}
 	}
 	c.path.Start(fixed.Point26_6{
-		X: fixed.Int26_6((x1 + c.curX) * 64),
-		Y: fixed.Int26_6((y1 + c.curY) * 64),
+		X: fixed.Int26_6(x1 * 64),
+		Y: fixed.Int26_6(y1 * 64),
 	})
 	c.path.Line(fixed.Point26_6{
-		X: fixed.Int26_6((x2 + c.curX) * 64),
-		Y: fixed.Int26_6((y2 + c.curY) * 64),
+		X: fixed.Int26_6(x2 * 64),
+		Y: fixed.Int26_6(y2 * 64),
 	})
 	return nil
 }
@@ -220,13 +244,13 @@ func polylineF(c *svgCursor, attrs []xml.Attr) error {
 	}
 	if len(c.points) > 4 {
 		c.path.Start(fixed.Point26_6{
-			X: fixed.Int26_6((c.points[0] + c.curX) * 64),
-			Y: fixed.Int26_6((c.points[1] + c.curY) * 64),
+			X: fixed.Int26_6(c.points[0] * 64),
+			Y: fixed.Int26_6(c.points[1] * 64),
 		})
 		for i := 2; i < len(c.points)-1; i += 2 {
 			c.path.Line(fixed.Point26_6{
-				X: fixed.Int26_6((c.points[i] + c.curX) * 64),
-				Y: fixed.Int26_6((c.points[i+1] + c.curY) * 64),
+				X: fixed.Int26_6(c.points[i] * 64),
+				Y: fixed.Int26_6(c.points[i+1] * 64),
 			})
 		}
 	}
@@ -267,173 +291,73 @@ func titleF(c *svgCursor, attrs []xml.Attr) error {
 	return nil
 }
 
+// defsF starts a container whose content is only drawn by use elements
 func defsF(c *svgCursor, attrs []xml.Attr) error {
-	c.inDefs = true
+	c.hidden++
 	return nil
 }
 
 func linearGradientF(c *svgCursor, attrs []xml.Attr) error {
-	var err error
-	c.inGrad = true
-	// interpretation of percentage in direction depends
-	// on gradientUnits: we first store the string values
-	// and resolve them in a second pass
-	directionStrings := [4]string{"0%", "0%", "100%", "0"} // default value
-	c.grad = &Gradient{Bounds: c.svg.ViewBox, Matrix: Identity}
-	for _, attr := range attrs {
-		switch attr.Name.Local {
-		case "id":
-			id := attr.Value
-			if len(id) >= 0 {
-				c.svg.grads[id] = c.grad
-			} else {
-				return errZeroLengthID
-			}
-		case "x1":
-			directionStrings[0] = attr.Value
-		case "y1":
-			directionStrings[1] = attr.Value
-		case "x2":
-			directionStrings[2] = attr.Value
-		case "y2":
-			directionStrings[3] = attr.Value
-		default:
-			err = c.readGradAttr(attr)
-		}
-		if err != nil {
-			return err
-		}
-	}
-	// now we can resolve percentages
-	bbox := Bounds{W: 1, H: 1} // default is ObjectBoundingBox
-	if c.grad.Units == UserSpaceOnUse {
-		bbox = c.grad.Bounds
-	}
-	var direction Linear
-	direction[0], err = bbox.resolveUnit(directionStrings[0], widthPercentage)
-	if err != nil {
-		return err
-	}
-	direction[1], err = bbox.resolveUnit(directionStrings[1], heightPercentage)
-	if err != nil {
-		return err
-	}
-	direction[2], err = bbox.resolveUnit(directionStrings[2], widthPercentage)
-	if err != nil {
-		return err
-	}
-	direction[3], err = bbox.resolveUnit(directionStrings[3], heightPercentage)
-	if err != nil {
-		return err
-	}
-	c.grad.Direction = direction
-	return nil
+	return c.startGradient(attrs, Linear{})
 }
 
 func radialGradientF(c *svgCursor, attrs []xml.Attr) error {
+	return c.startGradient(attrs, Radial{})
+}
+
+// startGradient starts a gradient element. Its attributes are only
+// compiled once the whole document is read, since they may be
+// inherited from the gradient referenced by its href attribute.
+func (c *svgCursor) startGradient(attrs []xml.Attr, direction gradientDirecter) error {
 	c.inGrad = true
-	c.grad = &Gradient{Bounds: c.svg.ViewBox, Matrix: Identity}
-	var setFx, setFy bool
-	var err error
-	directionStrings := [6]string{"50%", "50%", "50%", "50%", "50%", "50%"} // default values
+	c.grad = &Gradient{Direction: direction, Bounds: c.viewBox(), Matrix: Identity, attrs: make(map[string]string)}
 	for _, attr := range attrs {
 		switch attr.Name.Local {
 		case "id":
-			id := attr.Value
-			if len(id) >= 0 {
-				c.svg.grads[id] = c.grad
-			} else {
-				return errZeroLengthID
-			}
-		case "cx":
-			directionStrings[0] = attr.Value
-		case "cy":
-			directionStrings[1] = attr.Value
-		case "fx":
-			setFx = true
-			directionStrings[2] = attr.Value
-		case "fy":
-			setFy = true
-			directionStrings[3] = attr.Value
-		case "r":
-			directionStrings[4] = attr.Value
-		case "fr":
-			directionStrings[5] = attr.Value
+			c.svg.grads[attr.Value] = c.grad
+		case "href":
+			c.grad.href = attr.Value
 		default:
-			err = c.readGradAttr(attr)
-		}
-		if err != nil {
-			return err
+			for _, name := range gradientAttrs {
+				if attr.Name.Local == name {
+					c.grad.attrs[name] = attr.Value
+				}
+			}
 		}
 	}
-	if !setFx { // set fx to cx by default
-		directionStrings[2] = directionStrings[0]
-	}
-	if !setFy { // set fy to cy by default
-		directionStrings[3] = directionStrings[1]
-	}
+	return nil
+}
 
-	// now we can resolve percentages
-	bbox := Bounds{W: 1, H: 1} // default is ObjectBoundingBox
-	if c.grad.Units == UserSpaceOnUse {
-		bbox = c.grad.Bounds
-	}
-	var direction Radial
-	direction[0], err = bbox.resolveUnit(directionStrings[0], widthPercentage)
-	if err != nil {
-		return err
-	}
-	direction[1], err = bbox.resolveUnit(directionStrings[1], heightPercentage)
-	if err != nil {
-		return err
-	}
-	direction[2], err = bbox.resolveUnit(directionStrings[2], widthPercentage)
-	if err != nil {
-		return err
-	}
-	direction[3], err = bbox.resolveUnit(directionStrings[3], heightPercentage)
-	if err != nil {
-		return err
-	}
-	direction[4], err = bbox.resolveUnit(directionStrings[4], diagPercentage)
-	if err != nil {
-		return err
+func stopF(c *svgCursor, attrs []xml.Attr) error {
+	if !c.inGrad && c.mesh == nil {
+		return nil
 	}
-	direction[5], err = bbox.resolveUnit(directionStrings[5], diagPercentage)
+	stop := GradStop{Opacity: 1.0}
+	// parse style and push into attrs
+	attrs, err := appendStyleAttrs(attrs, "stop-color", "stop-opacity")
 	if err != nil {
 		return err
 	}
 
-	c.grad.Direction = direction
-	return nil
-}
-
-func stopF(c *svgCursor, attrs []xml.Attr) error {
-	var err error
-	if c.inGrad {
-		stop := GradStop{Opacity: 1.0}
-		// parse style and push into attrs
-		attrs, err = appendStyleAttrs(attrs, "stop-color", "stop-opacity")
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "offset":
+			stop.Offset, err = readFraction(attr.Value)
+		case "stop-color":
+			// todo: add current color inherit
+			var optColor optionnalColor
+			optColor, err = parseSVGColor(attr.Value)
+			stop.StopColor = optColor.asColor()
+		case "stop-opacity":
+			stop.Opacity, err = parseBasicFloat(attr.Value)
+		}
 		if err != nil {
 			return err
 		}
-
-		for _, attr := range attrs {
-			switch attr.Name.Local {
-			case "offset":
-				stop.Offset, err = readFraction(attr.Value)
-			case "stop-color":
-				// todo: add current color inherit
-				var optColor optionnalColor
-				optColor, err = parseSVGColor(attr.Value)
-				stop.StopColor = optColor.asColor()
-			case "stop-opacity":
-				stop.Opacity, err = parseBasicFloat(attr.Value)
-			}
-			if err != nil {
-				return err
-			}
-		}
+	}
+	if c.mesh != nil {
+		c.addMeshStop(attrs, stop)
+	} else {
 		c.grad.Stops = append(c.grad.Stops, stop)
 	}
 	return nil
@@ -443,6 +367,7 @@ func useF(c *svgCursor, attrs []xml.Attr) error {
 	var (
 		href string
 		x, y float64
+		w, h string // size of the viewport of a symbol
 		err  error
 	)
 	for _, attr := range attrs {
@@ -453,46 +378,54 @@ func useF(c *svgCursor, attrs []xml.Attr) error {
 			x, err = c.parseUnit(attr.Value, widthPercentage)
 		case "y":
 			y, err = c.parseUnit(attr.Value, heightPercentage)
+		case "width":
+			w = attr.Value
+		case "height":
+			h = attr.Value
 		}
 		if err != nil {
 			return err
 		}
 	}
-	c.curX, c.curY = x, y
-	defer func() {
-		c.curX, c.curY = 0, 0
-	}()
 	if href == "" {
 		return errors.New("only use tags with href is supported")
 	}
-	if !strings.HasPrefix(href, "#") {
-		return errors.New("only the ID CSS selector is supported")
+	name, id := c.splitRef(href)
+	doc, err := c.tokens(name)
+	if err != nil {
+		return c.handleError("%s", err)
 	}
-	defs, ok := c.svg.defs[href[1:]]
+	tokens, ok := doc.lookup(id)
 	if !ok {
-		return errors.New("href ID in use statement was not found in saved defs")
-	}
-	for _, def := range defs {
-		if def.Tag == "endg" {
-			// pop style
-			c.styleStack = c.styleStack[:len(c.styleStack)-1]
-			continue
-		}
-		if err = c.pushStyle(def.Attrs); err != nil {
-			return err
+		if name == c.name && c.base == c.name {
+			return errors.New("href ID in use statement was not found")
 		}
-		df, ok := drawFuncs[def.Tag]
-		if !ok {
-			errStr := "Cannot process svg element " + def.Tag
-			return c.handleError(errStr)
-		}
-		if err := df(c, def.Attrs); err != nil {
+		return c.handleError("element %s not found in %s", id, name)
+	}
+	if err = c.res.push(name+"#"+id, name != c.base); err != nil {
+		return c.handleError("%s", err)
+	}
+	base := c.base
+	c.base = name
+	defer func() {
+		c.res.pop()
+		c.base = base
+	}()
+	// x and y translate the referenced element, after the transform of the use element
+	style := &c.styleStack[len(c.styleStack)-1]
+	style.Transform = style.Transform.Mult(Identity.Translate(x, y))
+	if se := tokens[0].(xml.StartElement); se.Name.Local == "symbol" {
+		return c.useSymbol(se.Attr, tokens[1:len(tokens)-1], w, h)
+	}
+	return c.replay(tokens)
+}
+
+// replay processes the tokens of a referenced element, with the current style.
+func (c *svgCursor) replay(tokens []xml.Token) error {
+	for _, t := range tokens {
+		if err := c.readToken(t); err != nil {
 			return err
 		}
-		if def.Tag != "g" {
-			// pop style
-			c.styleStack = c.styleStack[:len(c.styleStack)-1]
-		}
 	}
 	return nil
 }
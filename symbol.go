@@ -0,0 +1,161 @@
+package svg
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// symbolF starts a symbol: like the content
+// of defs, symbols are only drawn by use elements.
+func symbolF(c *svgCursor, attrs []xml.Attr) error {
+	c.hidden++
+	return nil
+}
+
+// symbolViewport returns the viewport of a symbol, given its attributes,
+// in the user space of the use element, the view box of its content and
+// whether the content is clipped to the viewport. The size of the viewport,
+// if not empty, overrides the one of the symbol.
+func (c *svgCursor) symbolViewport(attrs []xml.Attr, w, h string) (viewport, box Bounds, aspectRatio AspectRatio, clip bool, err error) {
+	width, height := "100%", "100%"
+	clip = true
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "x":
+			viewport.X, err = c.parseUnit(attr.Value, widthPercentage)
+		case "y":
+			viewport.Y, err = c.parseUnit(attr.Value, heightPercentage)
+		case "width":
+			width = attr.Value
+		case "height":
+			height = attr.Value
+		case "viewBox":
+			box, err = c.parseViewBox(attr.Value)
+		case "preserveAspectRatio":
+			aspectRatio, err = parseAspectRatio(attr.Value)
+		case "overflow":
+			clip = attr.Value != "visible" && attr.Value != "auto"
+		}
+		if err != nil {
+			return
+		}
+	}
+	if w != "" {
+		width = w
+	}
+	if h != "" {
+		height = h
+	}
+	if viewport.W, err = c.parseUnit(width, widthPercentage); err != nil {
+		return
+	}
+	viewport.H, err = c.parseUnit(height, heightPercentage)
+	return
+}
+
+// useSymbol draws the content of the symbol with the given attributes, in
+// its viewport, clipped to it unless its overflow is visible. The size of
+// the viewport, if not empty, overrides the one of the symbol.
+func (c *svgCursor) useSymbol(attrs []xml.Attr, content []xml.Token, w, h string) error {
+	viewport, box, aspectRatio, clip, err := c.symbolViewport(attrs, w, h)
+	if err != nil {
+		return err
+	}
+	if err = c.pushStyle(attrs); err != nil {
+		return err
+	}
+	style := &c.styleStack[len(c.styleStack)-1]
+	if clip {
+		c.clipViewport(style, viewport)
+	}
+	if box.W > 0 && box.H > 0 {
+		style.Transform = style.Transform.Mult(aspectRatio.Transform(box, viewport))
+	} else {
+		box = Bounds{W: viewport.W, H: viewport.H}
+		style.Transform = style.Transform.Mult(Identity.Translate(viewport.X, viewport.Y))
+	}
+	c.viewports = append(c.viewports, box)
+	err = c.replay(content)
+	c.viewports = c.viewports[:len(c.viewports)-1]
+	c.styleStack = c.styleStack[:len(c.styleStack)-1]
+	return err
+}
+
+// Symbol returns the symbol element with the given id as a standalone
+// document, whose view box is the one of the symbol.
+func (s *Svg) Symbol(id string) (*Svg, error) {
+	tokens, ok := s.doc.lookup(id)
+	if !ok || tokens[0].(xml.StartElement).Name.Local != "symbol" {
+		return nil, fmt.Errorf("symbol %q not found", id)
+	}
+	attrs := tokens[0].(xml.StartElement).Attr
+	// the symbol may reference the definitions of the document, but
+	// registers its own definitions without changing the document
+	symbol := &Svg{
+		ViewBox:   s.ViewBox,
+		Transform: Identity,
+		SvgMasks:  copyMap(s.SvgMasks),
+		ClipPaths: copyMap(s.ClipPaths),
+		Views:     copyMap(s.Views),
+		grads:     make(map[string]*Gradient, len(s.grads)),
+		patterns:  make(map[string]*TilePattern, len(s.patterns)),
+		meshes:    copyMap(s.meshes),
+		doc:       s.doc,
+	}
+	// gradients and patterns are resolved again with the ones of the
+	// symbol, which replace the ones of the document with the same id
+	for id, g := range s.grads {
+		g := *g
+		symbol.grads[id] = &g
+	}
+	for id, p := range s.patterns {
+		p := *p
+		p.SvgPaths = append([]SvgPath(nil), p.SvgPaths...)
+		symbol.patterns[id] = &p
+	}
+	c := newSvgCursor(symbol, s.errorMode, s.options)
+	var (
+		width, height float64
+		hasViewBox    bool
+		err           error
+	)
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "viewBox":
+			symbol.ViewBox, err = c.parseViewBox(attr.Value)
+			hasViewBox = true
+		case "width":
+			symbol.Width = attr.Value
+			width, err = parseBasicFloat(attr.Value)
+		case "height":
+			symbol.Height = attr.Value
+			height, err = parseBasicFloat(attr.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !hasViewBox && width > 0 && height > 0 {
+		symbol.ViewBox = Bounds{W: width, H: height}
+	}
+	c.viewports = append(c.viewports, symbol.ViewBox)
+	if err = c.pushStyle(attrs); err != nil {
+		return nil, err
+	}
+	if err = c.replay(tokens[1 : len(tokens)-1]); err != nil {
+		return nil, err
+	}
+	if err = c.resolvePaintServers(); err != nil {
+		return nil, err
+	}
+	return symbol, nil
+}
+
+// copyMap returns a shallow copy of m
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	out := make(map[K]V, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,678 @@
+package svg
+
+// This file implements the layout of text elements into glyph outlines.
+
+import (
+	"encoding/xml"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+type (
+	// textCursor accumulates the content of the text element being parsed.
+	// Glyphs are only laid out once the whole element has been read.
+	textCursor struct {
+		chars   []textChar
+		spans   []textSpan
+		frames  []textFrame
+		adjusts []textAdjust
+		serial  int // used to identify frames
+	}
+
+	// textFrame holds the positioning attributes of an open text or tspan
+	// element. The lists are indexed by the characters of the element,
+	// starting at start.
+	textFrame struct {
+		serial         int
+		start          int
+		id             string
+		x, y, dx, dy   []float64
+		rotate         []float64
+		preserveSpaces bool
+		path           *textPath // set inside textPath elements
+		textLength     float64
+		adjustGlyphs   bool // lengthAdjust="spacingAndGlyphs"
+	}
+
+	// textAdjust stretches the characters in [start, end) to length
+	textAdjust struct {
+		start, end int
+		length     float64
+		glyphs     bool
+	}
+
+	// textSpan is a sequence of characters sharing the same style
+	textSpan struct {
+		style PathStyle
+		frame int // serial of the innermost frame
+		path  *textPath
+		id    string
+	}
+
+	// textChar is an addressable character and its resolved position attributes
+	textChar struct {
+		r          rune
+		span       int
+		x, y       float64
+		hasX, hasY bool
+		dx, dy     float64
+		rotate     float64
+	}
+
+	// textGlyph is a laid out character
+	textGlyph struct {
+		char     *textChar
+		font     *sfnt.Font
+		index    sfnt.GlyphIndex
+		x, y     float64 // origin of the glyph, relative to path if any
+		advance  float64
+		scale    float64 // user units per font unit
+		hscale   float64 // horizontal stretch, from lengthAdjust
+		baseline float64 // vertical offset of the alignment baseline
+		path     *textPath
+	}
+
+	// pathAdder is implemented by the types adding transformed
+	// curves to a path
+	pathAdder interface {
+		Start(a fixed.Point26_6)
+		Line(b fixed.Point26_6)
+		QuadBezier(b, c fixed.Point26_6)
+		CubeBezier(b, c, d fixed.Point26_6)
+	}
+)
+
+// parseLengthList parses a list of lengths, such as the x attribute of text elements
+func (c *svgCursor) parseLengthList(v string, asPerc percentageReference) ([]float64, error) {
+	fields := splitOnCommaOrSpace(v)
+	list := make([]float64, 0, len(fields))
+	for _, f := range fields {
+		l, err := c.parseUnit(f, asPerc)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, l)
+	}
+	return list, nil
+}
+
+// pushTextFrame reads the positioning attributes of a text or tspan element
+func (c *svgCursor) pushTextFrame(attrs []xml.Attr) error {
+	t := c.text
+	t.serial++
+	frame := textFrame{serial: t.serial, start: len(t.chars)}
+	if len(t.frames) > 0 {
+		parent := t.frames[len(t.frames)-1]
+		frame.preserveSpaces = parent.preserveSpaces
+		frame.path = parent.path
+		frame.id = parent.id
+	}
+	var err error
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "x":
+			frame.x, err = c.parseLengthList(attr.Value, widthPercentage)
+		case "y":
+			frame.y, err = c.parseLengthList(attr.Value, heightPercentage)
+		case "dx":
+			frame.dx, err = c.parseLengthList(attr.Value, widthPercentage)
+		case "dy":
+			frame.dy, err = c.parseLengthList(attr.Value, heightPercentage)
+		case "rotate":
+			frame.rotate, err = c.parseLengthList(attr.Value, diagPercentage)
+		case "textLength":
+			frame.textLength, err = c.parseUnit(attr.Value, widthPercentage)
+		case "lengthAdjust":
+			frame.adjustGlyphs = attr.Value == "spacingAndGlyphs"
+		case "space":
+			frame.preserveSpaces = attr.Value == "preserve"
+		case "id":
+			frame.id = attr.Value
+		}
+		if err != nil {
+			return err
+		}
+	}
+	t.frames = append(t.frames, frame)
+	return nil
+}
+
+func textF(c *svgCursor, attrs []xml.Attr) error {
+	c.text = &textCursor{}
+	return c.pushTextFrame(attrs)
+}
+
+func tspanF(c *svgCursor, attrs []xml.Attr) error {
+	if c.text == nil {
+		return c.handleError("<tspan> outside of a <text> element")
+	}
+	return c.pushTextFrame(attrs)
+}
+
+// popTextFrame is called when a tspan element ends
+func (c *svgCursor) popTextFrame() {
+	if c.text != nil && len(c.text.frames) > 1 {
+		c.text.endFrame()
+		c.text.frames = c.text.frames[:len(c.text.frames)-1]
+	}
+}
+
+// endFrame records the textLength of the innermost frame, now that
+// its characters are known.
+func (t *textCursor) endFrame() {
+	f := t.frames[len(t.frames)-1]
+	if f.textLength > 0 {
+		t.adjusts = append(t.adjusts, textAdjust{
+			start:  f.start,
+			end:    len(t.chars),
+			length: f.textLength,
+			glyphs: f.adjustGlyphs,
+		})
+	}
+}
+
+// listAt returns the value of the innermost list holding an entry for
+// the character at index i.
+func (t *textCursor) listAt(i int, list func(f *textFrame) []float64) (float64, bool) {
+	for j := len(t.frames) - 1; j >= 0; j-- {
+		f := &t.frames[j]
+		if l := list(f); i-f.start < len(l) {
+			return l[i-f.start], true
+		}
+	}
+	return 0, false
+}
+
+// rotateAt returns the rotation of the character at index i. The last
+// value of a rotate list applies to the remaining characters of its element.
+func (t *textCursor) rotateAt(i int) float64 {
+	for j := len(t.frames) - 1; j >= 0; j-- {
+		f := &t.frames[j]
+		if n := len(f.rotate); n > 0 {
+			if i-f.start < n {
+				return f.rotate[i-f.start]
+			}
+			return f.rotate[n-1]
+		}
+	}
+	return 0
+}
+
+// addChars appends the given character data, styled with style,
+// to the text being parsed.
+func (t *textCursor) addChars(s string, style PathStyle) {
+	frame := &t.frames[len(t.frames)-1]
+	if len(t.spans) == 0 || t.spans[len(t.spans)-1].frame != frame.serial {
+		t.spans = append(t.spans, textSpan{style: style, frame: frame.serial, path: frame.path, id: frame.id})
+	}
+	span := len(t.spans) - 1
+	for _, r := range s {
+		if !frame.preserveSpaces {
+			if r == '\n' || r == '\r' {
+				continue
+			}
+			if unicode.IsSpace(r) {
+				r = ' '
+				// collapse consecutive spaces and skip leading ones
+				if len(t.chars) == 0 || t.chars[len(t.chars)-1].r == ' ' {
+					continue
+				}
+			}
+		} else if unicode.IsSpace(r) {
+			r = ' '
+		}
+		i := len(t.chars)
+		ch := textChar{r: r, span: span}
+		ch.x, ch.hasX = t.listAt(i, func(f *textFrame) []float64 { return f.x })
+		ch.y, ch.hasY = t.listAt(i, func(f *textFrame) []float64 { return f.y })
+		ch.dx, _ = t.listAt(i, func(f *textFrame) []float64 { return f.dx })
+		ch.dy, _ = t.listAt(i, func(f *textFrame) []float64 { return f.dy })
+		ch.rotate = t.rotateAt(i)
+		t.chars = append(t.chars, ch)
+	}
+}
+
+// layout positions the glyphs of the text, using the fonts returned by lookup
+func (t *textCursor) layout(lookup func(FontOptions) *sfnt.Font) []textGlyph {
+	var buf sfnt.Buffer
+	glyphs := make([]textGlyph, len(t.chars))
+	for i := range t.chars {
+		ch := &t.chars[i]
+		span := &t.spans[ch.span]
+		g := &glyphs[i]
+		g.char, g.path, g.hscale = ch, span.path, 1
+		if g.font = lookup(span.style.Font); g.font == nil {
+			// the glyph is not drawn, but its position is still
+			// reported by Svg.Texts, so estimate its advance
+			g.advance = span.style.Font.Size/2 + span.style.Text.LetterSpacing
+			continue
+		}
+		g.measure(&buf, &span.style.Text, span.style.Font.Size)
+		if i > 0 {
+			if prev := &glyphs[i-1]; prev.font == g.font && prev.scale == g.scale {
+				ppem := fixed.I(int(g.font.UnitsPerEm()))
+				if kern, err := g.font.Kern(&buf, prev.index, g.index, ppem, font.HintingNone); err == nil {
+					prev.advance += float64(kern) / 64 * g.scale
+				}
+			}
+		}
+	}
+	t.adjustLengths(glyphs)
+	t.position(glyphs)
+	return glyphs
+}
+
+// measure computes the advance and baseline offset of the glyph
+func (g *textGlyph) measure(buf *sfnt.Buffer, opts *TextOptions, size float64) {
+	ppem := fixed.I(int(g.font.UnitsPerEm()))
+	g.scale = size / float64(g.font.UnitsPerEm())
+	g.index, _ = g.font.GlyphIndex(buf, g.char.r)
+	if adv, err := g.font.GlyphAdvance(buf, g.index, ppem, font.HintingNone); err == nil {
+		g.advance = float64(adv) / 64 * g.scale
+	}
+	g.advance += opts.LetterSpacing
+	if g.char.r == ' ' {
+		g.advance += opts.WordSpacing
+	}
+
+	baseline := opts.AlignmentBaseline
+	if baseline == BaselineAuto {
+		baseline = opts.DominantBaseline
+	}
+	if baseline == BaselineAuto || baseline == BaselineAlphabetic {
+		return
+	}
+	metrics, err := g.font.Metrics(buf, ppem, font.HintingNone)
+	if err != nil {
+		return
+	}
+	ascent := float64(metrics.Ascent) / 64 * g.scale
+	descent := float64(metrics.Descent) / 64 * g.scale
+	switch baseline {
+	case BaselineMiddle:
+		g.baseline = float64(metrics.XHeight) / 64 * g.scale / 2
+	case BaselineCentral:
+		g.baseline = (ascent - descent) / 2
+	case BaselineMathematical:
+		g.baseline = ascent / 2
+	case BaselineHanging:
+		g.baseline = ascent * 0.8
+	case BaselineTextBeforeEdge:
+		g.baseline = ascent
+	case BaselineTextAfterEdge, BaselineIdeographic:
+		g.baseline = -descent
+	}
+}
+
+// adjustLengths applies the textLength attributes, from the innermost element
+func (t *textCursor) adjustLengths(glyphs []textGlyph) {
+	for _, a := range t.adjusts {
+		if a.end > len(glyphs) {
+			a.end = len(glyphs)
+		}
+		var natural float64
+		for _, g := range glyphs[a.start:a.end] {
+			natural += g.advance
+		}
+		n := a.end - a.start
+		if natural <= 0 || n < 1 {
+			continue
+		}
+		if a.glyphs {
+			f := a.length / natural
+			for i := a.start; i < a.end; i++ {
+				glyphs[i].advance *= f
+				glyphs[i].hscale *= f
+			}
+		} else if n > 1 {
+			// the extra space goes between the characters
+			d := (a.length - natural) / float64(n-1)
+			for i := a.start; i < a.end-1; i++ {
+				glyphs[i].advance += d
+			}
+		}
+	}
+}
+
+// position sets the origin of the glyphs, moving each text chunk
+// according to its text-anchor.
+func (t *textCursor) position(glyphs []textGlyph) {
+	var (
+		penX, penY float64
+		curPath    *textPath
+		chunk      int // first glyph of the current text chunk
+	)
+	endChunk := func(end int) {
+		if chunk >= end {
+			return
+		}
+		var shift float64
+		switch t.spans[glyphs[chunk].char.span].style.Text.Anchor {
+		case TextAnchorMiddle:
+			shift = -(penX - glyphs[chunk].x) / 2
+		case TextAnchorEnd:
+			shift = -(penX - glyphs[chunk].x)
+		}
+		for i := chunk; i < end; i++ {
+			glyphs[i].x += shift
+		}
+		penX += shift
+		chunk = end
+	}
+	for i := range glyphs {
+		g := &glyphs[i]
+		ch := g.char
+		if g.path != curPath {
+			endChunk(i)
+			if curPath != nil {
+				// the text following a text path continues
+				// from the end of its last glyph
+				if l := curPath.outline.length(); penX > l {
+					penX = l
+				}
+				penX, penY, _ = curPath.outline.atExtended(penX)
+			}
+			if g.path != nil {
+				// inside a text path, penX is the distance along the
+				// path and penY the offset perpendicular to it
+				penX, penY = g.path.startOffset, 0
+			}
+			curPath = g.path
+		}
+		absY := ch.hasY && curPath == nil
+		if ch.hasX || absY {
+			// an absolute position starts a new text chunk
+			endChunk(i)
+		}
+		if ch.hasX {
+			penX = ch.x
+		}
+		if absY {
+			penY = ch.y
+		}
+		penX += ch.dx
+		penY += ch.dy
+		g.x, g.y = penX, penY
+		penX += g.advance
+	}
+	endChunk(len(glyphs))
+}
+
+// addTo appends the outline of the glyph to the path
+func (g *textGlyph) addTo(p *Path, buf *sfnt.Buffer) error {
+	ppem := fixed.I(int(g.font.UnitsPerEm()))
+	segments, err := g.font.LoadGlyph(buf, g.index, ppem, nil)
+	if err != nil {
+		return err
+	}
+	var q pathAdder
+	if g.path == nil {
+		q = &matrixAdder{M: g.matrix(0, 0, 0, g.x, g.y+g.baseline), path: p}
+	} else {
+		// glyphs whose midpoint is not on the path are not rendered
+		mid := g.x + g.advance/2
+		x, y, angle, ok := g.path.outline.at(mid)
+		if !ok {
+			return nil
+		}
+		if g.path.stretch {
+			q = &pathWarper{path: p, outline: g.path.outline, sx: g.scale * g.hscale, sy: g.scale, x: g.x, y: g.y + g.baseline}
+		} else {
+			// the midpoint of the glyph is set on the path
+			q = &matrixAdder{M: g.matrix(x, y, angle, -g.advance/2, g.y+g.baseline), path: p}
+		}
+	}
+	open := false
+	for _, s := range segments {
+		switch s.Op {
+		case sfnt.SegmentOpMoveTo:
+			if open {
+				p.Stop(true)
+			}
+			q.Start(s.Args[0])
+			open = true
+		case sfnt.SegmentOpLineTo:
+			q.Line(s.Args[0])
+		case sfnt.SegmentOpQuadTo:
+			q.QuadBezier(s.Args[0], s.Args[1])
+		case sfnt.SegmentOpCubeTo:
+			q.CubeBezier(s.Args[0], s.Args[1], s.Args[2])
+		}
+	}
+	if open {
+		p.Stop(true)
+	}
+	return nil
+}
+
+// matrix returns the matrix mapping the glyph outline to user space.
+// The glyph is scaled, rotated around its origin by its rotate value,
+// moved to (ox, oy), then rotated by angle and moved to (x, y).
+func (g *textGlyph) matrix(x, y, angle, ox, oy float64) Matrix2D {
+	sin, cos := math.Sincos(angle)
+	rsin, rcos := math.Sincos(angle + g.char.rotate*math.Pi/180)
+	sx, sy := g.scale*g.hscale, g.scale
+	return Matrix2D{
+		A: sx * rcos, B: sx * rsin,
+		C: -sy * rsin, D: sy * rcos,
+		E: x + cos*ox - sin*oy,
+		F: y + sin*ox + cos*oy,
+	}
+}
+
+// endText lays out the text element which just ended, and stores
+// the glyph outlines of each span as a path.
+func (c *svgCursor) endText() error {
+	t := c.text
+	c.text = nil
+	if t == nil {
+		return nil
+	}
+	if n := len(t.chars); n > 0 && t.chars[n-1].r == ' ' && !t.frames[0].preserveSpaces {
+		t.chars = t.chars[:n-1]
+	}
+	if len(t.chars) == 0 {
+		return nil
+	}
+	t.endFrame()
+	glyphs := t.layout(c.lookupFont)
+	var (
+		buf     sfnt.Buffer
+		missing bool
+	)
+	for i := 0; i < len(glyphs); {
+		span := &t.spans[glyphs[i].char.span]
+		run := TextRun{Font: span.style.Font, Transform: span.style.Transform, ID: span.id}
+		run.X, run.Y = glyphs[i].position()
+		var (
+			path Path
+			sb   strings.Builder
+		)
+		for ; i < len(glyphs) && &t.spans[glyphs[i].char.span] == span; i++ {
+			sb.WriteRune(glyphs[i].char.r)
+			if glyphs[i].font == nil {
+				missing = true
+				continue
+			}
+			if err := glyphs[i].addTo(&path, &buf); err != nil {
+				if err = c.handleError("cannot load glyph for %q: %s", glyphs[i].char.r, err); err != nil {
+					return err
+				}
+			}
+		}
+		run.Text = sb.String()
+		c.svg.texts = append(c.svg.texts, run)
+		if len(path) > 0 {
+			c.appendPath(path, span.style)
+		}
+	}
+	if missing && c.errorMode == WarnErrorMode {
+		log.Println("No font available to draw text " + strconv.Quote(t.String()))
+	}
+	return nil
+}
+
+// position returns the origin of the glyph in the user space of the text
+func (g *textGlyph) position() (x, y float64) {
+	if g.path == nil {
+		return g.x, g.y
+	}
+	x, y, angle := g.path.outline.atExtended(g.x)
+	sin, cos := math.Sincos(angle)
+	return x - sin*g.y, y + cos*g.y
+}
+
+// TextRun is a sequence of characters of a text element sharing the same style.
+type TextRun struct {
+	Text string
+	// X and Y locate the first character, in the user space of the text element.
+	// When no font is available for the text, advances are estimated.
+	X, Y      float64
+	Font      FontOptions
+	Transform Matrix2D // transform from the user space of the text element
+	ID        string   // id of the innermost element holding the run, if any
+}
+
+// Texts returns the runs of the text elements, in document order.
+// They are available even if no font was provided when parsing.
+func (s *Svg) Texts() []TextRun {
+	return s.texts
+}
+
+// String returns the text content, after white space processing
+func (t *textCursor) String() string {
+	var sb strings.Builder
+	for _, ch := range t.chars {
+		sb.WriteRune(ch.r)
+	}
+	return sb.String()
+}
+
+// fontSizes maps the absolute font-size keywords to pixels
+var fontSizes = map[string]float64{
+	"xx-small": 9,
+	"x-small":  10,
+	"small":    13,
+	"medium":   16,
+	"large":    18,
+	"x-large":  24,
+	"xx-large": 32,
+}
+
+// parseFontSize reads a font-size value; relative sizes refer to parent.
+func (c *svgCursor) parseFontSize(v string, parent float64) (float64, error) {
+	if size, ok := fontSizes[v]; ok {
+		return size, nil
+	}
+	switch {
+	case v == "larger":
+		return parent * 1.2, nil
+	case v == "smaller":
+		return parent / 1.2, nil
+	case strings.HasSuffix(v, "em"):
+		f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(v, "em")), 64)
+		return f * parent, err
+	case strings.HasSuffix(v, "%"):
+		f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(v, "%")), 64)
+		return f / 100 * parent, err
+	}
+	return c.parseUnit(v, diagPercentage)
+}
+
+// TextAnchor is the type for the text-anchor property
+type TextAnchor uint8
+
+// SVG text-anchor constants
+const (
+	TextAnchorStart TextAnchor = iota
+	TextAnchorMiddle
+	TextAnchorEnd
+)
+
+// Baseline is the type for the dominant-baseline and alignment-baseline properties
+type Baseline uint8
+
+// SVG baseline constants
+const (
+	BaselineAuto Baseline = iota
+	BaselineAlphabetic
+	BaselineIdeographic
+	BaselineHanging
+	BaselineMathematical
+	BaselineCentral
+	BaselineMiddle
+	BaselineTextBeforeEdge // also text-top
+	BaselineTextAfterEdge  // also text-bottom
+)
+
+var baselines = map[string]Baseline{
+	"auto":             BaselineAuto,
+	"alphabetic":       BaselineAlphabetic,
+	"baseline":         BaselineAlphabetic,
+	"ideographic":      BaselineIdeographic,
+	"hanging":          BaselineHanging,
+	"mathematical":     BaselineMathematical,
+	"central":          BaselineCentral,
+	"middle":           BaselineMiddle,
+	"text-before-edge": BaselineTextBeforeEdge,
+	"text-top":         BaselineTextBeforeEdge,
+	"before-edge":      BaselineTextBeforeEdge,
+	"text-after-edge":  BaselineTextAfterEdge,
+	"text-bottom":      BaselineTextAfterEdge,
+	"after-edge":       BaselineTextAfterEdge,
+}
+
+// parseSpacing reads a letter-spacing or word-spacing value
+func (c *svgCursor) parseSpacing(v string, fontSize float64) (float64, error) {
+	switch {
+	case v == "normal":
+		return 0, nil
+	case strings.HasSuffix(v, "em"):
+		f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(v, "em")), 64)
+		return f * fontSize, err
+	}
+	return c.parseUnit(v, widthPercentage)
+}
+
+// parseFontWeight reads a font-weight value; relative weights refer to parent.
+func parseFontWeight(v string, parent int) (int, error) {
+	switch v {
+	case "normal":
+		return 400, nil
+	case "bold":
+		return 700, nil
+	case "bolder":
+		switch {
+		case parent < 350:
+			return 400, nil
+		case parent < 550:
+			return 700, nil
+		default:
+			return 900, nil
+		}
+	case "lighter":
+		switch {
+		case parent < 550:
+			return 100, nil
+		case parent < 750:
+			return 400, nil
+		default:
+			return 700, nil
+		}
+	}
+	w, err := strconv.Atoi(v)
+	if err != nil {
+		return parent, err
+	}
+	if w < 1 || w > 1000 {
+		return parent, errParamMismatch
+	}
+	return w, nil
+}
@@ -0,0 +1,318 @@
+package svg
+
+// This file implements the layout of glyphs along a path,
+// as required by the textPath element.
+
+import (
+	"encoding/xml"
+	"math"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/math/fixed"
+)
+
+type (
+	// textPath is the geometry a textPath element lays its glyphs along
+	textPath struct {
+		outline     polyline
+		startOffset float64
+		stretch     bool // method="stretch"
+	}
+
+	// polyline is a flattened path, used to measure distances along it
+	polyline []polyPoint
+
+	polyPoint struct {
+		x, y float64
+		dist float64 // distance from the start of the path
+		move bool    // start of a sub path
+	}
+)
+
+// flattenPath approximates the path, transformed by m, with line segments
+func flattenPath(p Path, m Matrix2D) polyline {
+	var (
+		pl             polyline
+		lastX, lastY   float64
+		startX, startY float64
+	)
+	lineTo := func(x, y float64, move bool) {
+		if move {
+			pl = append(pl, polyPoint{x: x, y: y, move: true})
+			if len(pl) > 1 {
+				pl[len(pl)-1].dist = pl[len(pl)-2].dist
+			}
+		} else if x != lastX || y != lastY {
+			d := pl[len(pl)-1].dist + math.Hypot(x-lastX, y-lastY)
+			pl = append(pl, polyPoint{x: x, y: y, dist: d})
+		}
+		lastX, lastY = x, y
+	}
+	toFloat := func(pt fixed.Point26_6) (float64, float64) {
+		return m.Transform(float64(pt.X)/64, float64(pt.Y)/64)
+	}
+	for _, op := range p {
+		switch op := op.(type) {
+		case OpMoveTo:
+			startX, startY = toFloat(fixed.Point26_6(op))
+			lineTo(startX, startY, true)
+		case OpLineTo:
+			if len(pl) == 0 {
+				continue
+			}
+			x, y := toFloat(fixed.Point26_6(op))
+			lineTo(x, y, false)
+		case OpQuadTo:
+			if len(pl) == 0 {
+				continue
+			}
+			x0, y0 := lastX, lastY
+			x1, y1 := toFloat(op[0])
+			x2, y2 := toFloat(op[1])
+			n := flatteningSteps(math.Hypot(x1-x0, y1-y0) + math.Hypot(x2-x1, y2-y1))
+			for i := 1; i <= n; i++ {
+				x, y := quadPointAt(x0, y0, x1, y1, x2, y2, float64(i)/float64(n))
+				lineTo(x, y, false)
+			}
+		case OpCubicTo:
+			if len(pl) == 0 {
+				continue
+			}
+			x0, y0 := lastX, lastY
+			x1, y1 := toFloat(op[0])
+			x2, y2 := toFloat(op[1])
+			x3, y3 := toFloat(op[2])
+			n := flatteningSteps(math.Hypot(x1-x0, y1-y0) + math.Hypot(x2-x1, y2-y1) + math.Hypot(x3-x2, y3-y2))
+			for i := 1; i <= n; i++ {
+				x, y := cubicPointAt(x0, y0, x1, y1, x2, y2, x3, y3, float64(i)/float64(n))
+				lineTo(x, y, false)
+			}
+		case OpClose:
+			if len(pl) == 0 {
+				continue
+			}
+			lineTo(startX, startY, false)
+		}
+	}
+	return pl
+}
+
+// length returns the total length of the polyline
+func (pl polyline) length() float64 {
+	if len(pl) == 0 {
+		return 0
+	}
+	return pl[len(pl)-1].dist
+}
+
+// at returns the point at distance d along the polyline and the
+// angle of the path direction there. ok is false if d is not on the path.
+func (pl polyline) at(d float64) (x, y, angle float64, ok bool) {
+	if len(pl) < 2 || d < 0 || d > pl.length() {
+		return 0, 0, 0, false
+	}
+	j := sort.Search(len(pl), func(i int) bool { return pl[i].dist >= d })
+	for j < len(pl) && (j == 0 || pl[j].move) {
+		j++
+	}
+	if j == len(pl) {
+		return 0, 0, 0, false
+	}
+	p0, p1 := pl[j-1], pl[j]
+	t := 0.
+	if p1.dist > p0.dist {
+		t = (d - p0.dist) / (p1.dist - p0.dist)
+	}
+	return p0.x + t*(p1.x-p0.x), p0.y + t*(p1.y-p0.y), math.Atan2(p1.y-p0.y, p1.x-p0.x), true
+}
+
+// atExtended is like at, but extends the ends of the polyline along
+// their tangents, so that any distance maps to a point.
+func (pl polyline) atExtended(d float64) (x, y, angle float64) {
+	if len(pl) < 2 {
+		return 0, 0, 0
+	}
+	var extra float64
+	switch l := pl.length(); {
+	case d < 0:
+		d, extra = 0, d
+	case d > l:
+		d, extra = l, d-l
+	}
+	x, y, angle, _ = pl.at(d)
+	return x + extra*math.Cos(angle), y + extra*math.Sin(angle), angle
+}
+
+// reverse returns the polyline walked in the opposite direction
+func (pl polyline) reverse() polyline {
+	out := make(polyline, 0, len(pl))
+	total := pl.length()
+	for i := len(pl) - 1; i >= 0; i-- {
+		p := pl[i]
+		// the start of a sub path, walked backward, is where the previous one ends
+		move := i == len(pl)-1 || pl[i+1].move
+		out = append(out, polyPoint{x: p.x, y: p.y, dist: total - p.dist, move: move})
+	}
+	return out
+}
+
+// shapeFuncs compile the outline of the elements a textPath may follow
+var shapeFuncs = map[string]svgFunc{
+	"path":     pathF,
+	"rect":     rectF,
+	"circle":   circleF,
+	"ellipse":  circleF,
+	"line":     lineF,
+	"polyline": polylineF,
+	"polygon":  polygonF,
+}
+
+// lookupShape returns the name and the attributes of
+// the path or basic shape element with the given id
+func (c *svgCursor) lookupShape(id string) (string, []xml.Attr, bool) {
+	tokens, ok := c.svg.doc.lookup(id)
+	if !ok {
+		return "", nil, false
+	}
+	if se := tokens[0].(xml.StartElement); shapeFuncs[se.Name.Local] != nil {
+		return se.Name.Local, se.Attr, true
+	}
+	return "", nil, false
+}
+
+// compileTextPath returns the outline of the shape element name with the
+// given attributes, in the user space of the text element, and the length
+// given by its pathLength attribute if any.
+func (c *svgCursor) compileTextPath(name string, attrs []xml.Attr) (polyline, float64, error) {
+	// the shape is compiled as if it was drawn, without
+	// disturbing the path of the element being read
+	path := c.path
+	c.path = nil
+	err := shapeFuncs[name](c, attrs)
+	shape := c.path
+	c.path = path
+	if err != nil {
+		return nil, 0, err
+	}
+	var (
+		m          = Identity
+		pathLength float64
+	)
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "transform":
+			// the transform of the referenced shape is relative to the text element
+			m, err = c.parseTransformFrom(Identity, attr.Value)
+		case "pathLength":
+			pathLength, err = parseBasicFloat(attr.Value)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return flattenPath(shape, m), pathLength, nil
+}
+
+func textPathF(c *svgCursor, attrs []xml.Attr) error {
+	if c.text == nil {
+		return c.handleError("<textPath> outside of a <text> element")
+	}
+	var (
+		tp          = &textPath{}
+		href, d     string
+		startOffset string
+		reverse     bool
+		err         error
+	)
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "href":
+			href = attr.Value
+		case "path":
+			d = attr.Value
+		case "startOffset":
+			startOffset = attr.Value
+		case "method":
+			tp.stretch = attr.Value == "stretch"
+		case "side":
+			reverse = attr.Value == "right"
+		case "spacing":
+			// glyphs are laid out with their exact advances
+			if attr.Value != "exact" {
+				if err = c.handleError("unsupported value '%s' for <textPath spacing>", attr.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	var pathLength float64
+	if d != "" {
+		tp.outline, pathLength, err = c.compileTextPath("path", []xml.Attr{{Name: xml.Name{Local: "d"}, Value: d}})
+	} else if name, shapeAttrs, ok := c.lookupShape(strings.TrimPrefix(href, "#")); ok && strings.HasPrefix(href, "#") {
+		tp.outline, pathLength, err = c.compileTextPath(name, shapeAttrs)
+	} else {
+		err = c.handleError("path %q of <textPath> was not found", href)
+	}
+	if err != nil {
+		return err
+	}
+	if reverse {
+		tp.outline = tp.outline.reverse()
+	}
+	if startOffset != "" {
+		length := tp.outline.length()
+		offset, isPerc, err := parseUnit(startOffset)
+		if err != nil {
+			return err
+		}
+		if isPerc {
+			offset = offset / 100 * length
+		} else if pathLength > 0 {
+			offset *= length / pathLength
+		}
+		tp.startOffset = offset
+	}
+	if err = c.pushTextFrame(attrs); err != nil {
+		return err
+	}
+	c.text.frames[len(c.text.frames)-1].path = tp
+	return nil
+}
+
+// pathWarper maps the points of a glyph outline onto a path, bending the
+// glyph along the path direction. The x axis of the glyph is the distance
+// along the path, offset by x, and its y axis the normal to the path, offset by y.
+type pathWarper struct {
+	path    *Path
+	outline polyline
+	sx, sy  float64
+	x, y    float64
+}
+
+func (w *pathWarper) warp(a fixed.Point26_6) fixed.Point26_6 {
+	along := float64(a.X)/64*w.sx + w.x
+	normal := float64(a.Y)/64*w.sy + w.y
+	x, y, angle := w.outline.atExtended(along)
+	return toFixedP(x-normal*math.Sin(angle), y+normal*math.Cos(angle))
+}
+
+// Start starts a new curve at the given point.
+func (w *pathWarper) Start(a fixed.Point26_6) {
+	w.path.Start(w.warp(a))
+}
+
+// Line adds a linear segment to the current curve.
+func (w *pathWarper) Line(b fixed.Point26_6) {
+	w.path.Line(w.warp(b))
+}
+
+// QuadBezier adds a quadratic segment to the current curve.
+func (w *pathWarper) QuadBezier(b, c fixed.Point26_6) {
+	w.path.QuadBezier(w.warp(b), w.warp(c))
+}
+
+// CubeBezier adds a cubic segment to the current curve.
+func (w *pathWarper) CubeBezier(b, c, d fixed.Point26_6) {
+	w.path.CubeBezier(w.warp(b), w.warp(c), w.warp(d))
+}
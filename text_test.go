@@ -0,0 +1,341 @@
+package svg
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func testFonts(t *testing.T) *FontCollection {
+	fc := NewFontCollection()
+	for _, data := range [][]byte{goregular.TTF, gobold.TTF, goitalic.TTF, gomono.TTF} {
+		if err := fc.AddFont(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fc
+}
+
+// pathExtent returns the extent of the path, in user units
+func pathExtent(p Path) (minX, minY, maxX, maxY float64) {
+	minX, minY, maxX, maxY = 1e9, 1e9, -1e9, -1e9
+	add := func(pt [2]float64) {
+		if pt[0] < minX {
+			minX = pt[0]
+		}
+		if pt[0] > maxX {
+			maxX = pt[0]
+		}
+		if pt[1] < minY {
+			minY = pt[1]
+		}
+		if pt[1] > maxY {
+			maxY = pt[1]
+		}
+	}
+	for _, op := range p {
+		switch op := op.(type) {
+		case OpMoveTo:
+			add([2]float64{float64(op.X) / 64, float64(op.Y) / 64})
+		case OpLineTo:
+			add([2]float64{float64(op.X) / 64, float64(op.Y) / 64})
+		case OpQuadTo:
+			add([2]float64{float64(op[1].X) / 64, float64(op[1].Y) / 64})
+		case OpCubicTo:
+			add([2]float64{float64(op[2].X) / 64, float64(op[2].Y) / 64})
+		}
+	}
+	return
+}
+
+func TestFontCollection(t *testing.T) {
+	fc := testFonts(t)
+	if fc.Font("Go", 700, FontStyleNormal) != fc.faces[1].font {
+		t.Error("expected bold face")
+	}
+	if fc.Font("go", 400, FontStyleItalic) != fc.faces[2].font {
+		t.Error("expected italic face")
+	}
+	if fc.Font("Go Mono", 700, FontStyleNormal) != fc.faces[3].font {
+		t.Error("expected the only mono face")
+	}
+	if fc.Font("Arial", 400, FontStyleNormal) != nil {
+		t.Error("unexpected face for unknown family")
+	}
+	if fc.Font("", 400, FontStyleNormal) != fc.faces[0].font {
+		t.Error("expected default face")
+	}
+}
+
+func TestLoadFontDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"regular.ttf":  goregular.TTF,
+		"corrupt.ttf":  []byte("not a font"),
+		"sub/bold.ttf": gobold.TTF,
+		"readme.txt":   []byte("ignored"),
+	} {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fc, err := LoadFontDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "corrupt.ttf") {
+		t.Errorf("expected an error for the corrupt font, got %v", err)
+	}
+	if fc == nil || len(fc.faces) != 2 {
+		t.Fatalf("expected the other fonts to be loaded, got %v", fc)
+	}
+}
+
+func TestText(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 100">
+	<text x="10" y="50" font-family="Arial, Go" font-size="20">Hello
+		<tspan font-weight="bold" fill="red" dy="10">World</tspan>
+	</text>
+	</svg>`
+	s, err := Parse(strings.NewReader(src), StrictErrorMode, Fonts(testFonts(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SvgPaths) != 2 {
+		t.Fatalf("expected 2 paths, got %d", len(s.SvgPaths))
+	}
+	minX, _, maxX1, maxY := pathExtent(s.SvgPaths[0].Path)
+	if minX < 10 || minX > 14 || maxY > 50.5 {
+		t.Errorf("unexpected extent of first span: %f %f", minX, maxY)
+	}
+	minX2, _, _, maxY2 := pathExtent(s.SvgPaths[1].Path)
+	if minX2 < maxX1 || maxY2 < 55 || maxY2 > 60.5 {
+		t.Errorf("unexpected extent of second span: %f %f", minX2, maxY2)
+	}
+	if s.SvgPaths[1].Style.Font.Weight != 700 {
+		t.Error("expected bold tspan")
+	}
+	if c, ok := s.SvgPaths[1].Style.FillerColor.(PlainColor); !ok || c.R != 0xff {
+		t.Error("expected red tspan")
+	}
+}
+
+func TestTextWithoutFonts(t *testing.T) {
+	const src = `<svg viewBox="0 0 200 100"><text x="10" y="50">Hello</text></svg>`
+	s, err := Parse(strings.NewReader(src), StrictErrorMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SvgPaths) != 0 {
+		t.Fatal("expected no paths without fonts")
+	}
+}
+
+func TestTextPath(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 200">
+	<defs><path id="down" d="M100,20 V180"/></defs>
+	<text font-size="10"><textPath href="#down" startOffset="10">abc</textPath></text>
+	<text font-size="10"><textPath href="#down" startOffset="100%">abc</textPath></text>
+	</svg>`
+	s, err := Parse(strings.NewReader(src), StrictErrorMode, Fonts(testFonts(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SvgPaths) != 1 {
+		t.Fatalf("expected glyphs past the end of the path to be dropped, got %d paths", len(s.SvgPaths))
+	}
+	minX, minY, maxX, maxY := pathExtent(s.SvgPaths[0].Path)
+	// the path goes down, so the glyphs are rotated clockwise, with
+	// their baseline on the path and their top on the right
+	if minX < 99.5 || maxX > 110 || minY < 29.5 || maxY > 50 {
+		t.Errorf("unexpected glyph extent %f %f %f %f", minX, minY, maxX, maxY)
+	}
+}
+
+func TestTextPathShape(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 200">
+	<defs><circle id="ring" cx="100" cy="100" r="50"/></defs>
+	<text font-size="10"><textPath href="#ring" spacing="%s">abc</textPath></text>
+	</svg>`
+	s, err := Parse(strings.NewReader(fmt.Sprintf(src, "exact")), StrictErrorMode, Fonts(testFonts(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SvgPaths) != 1 {
+		t.Fatalf("expected glyphs along the circle, got %d paths", len(s.SvgPaths))
+	}
+	// the circle starts at its rightmost point, going down
+	minX, minY, maxX, maxY := pathExtent(s.SvgPaths[0].Path)
+	if minX < 140 || maxX > 160 || minY < 95 || maxY > 130 {
+		t.Errorf("unexpected glyph extent %f %f %f %f", minX, minY, maxX, maxY)
+	}
+	if _, err = Parse(strings.NewReader(fmt.Sprintf(src, "auto")), StrictErrorMode, Fonts(testFonts(t))); err == nil {
+		t.Error("expected an error for the unsupported spacing")
+	}
+}
+
+func TestTextLayout(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 200">
+	<text x="100" y="50" text-anchor="middle">centered</text>
+	<text x="100" y="50" text-anchor="end" dominant-baseline="text-before-edge">end</text>
+	<text x="10" y="100" textLength="150" lengthAdjust="spacingAndGlyphs">stretched</text>
+	</svg>`
+	s, err := Parse(strings.NewReader(src), StrictErrorMode, Fonts(testFonts(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.SvgPaths) != 3 {
+		t.Fatalf("expected 3 paths, got %d", len(s.SvgPaths))
+	}
+	minX, _, maxX, _ := pathExtent(s.SvgPaths[0].Path)
+	if mid := (minX + maxX) / 2; mid < 99 || mid > 101 {
+		t.Errorf("expected text centered on 100, got %f", mid)
+	}
+	_, minY, maxX, _ := pathExtent(s.SvgPaths[1].Path)
+	if maxX > 100 || maxX < 98 || minY < 50 {
+		t.Errorf("expected text ending at 100 below 50, got %f %f", maxX, minY)
+	}
+	minX, _, maxX, _ = pathExtent(s.SvgPaths[2].Path)
+	if minX < 10 || maxX > 160 || maxX < 155 {
+		t.Errorf("expected text stretched between 10 and 160, got %f %f", minX, maxX)
+	}
+}
+
+func TestTexts(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 200">
+	<g transform="translate(10,20)">
+		<text id="label" x="5" y="15" font-family="Go" font-size="12">Pump <tspan id="unit" font-weight="bold">P-101</tspan></text>
+	</g>
+	</svg>`
+	for _, opts := range [][]ParseOption{nil, {Fonts(testFonts(t))}} {
+		s, err := Parse(strings.NewReader(src), StrictErrorMode, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs := s.Texts()
+		if len(runs) != 2 {
+			t.Fatalf("expected 2 runs, got %d", len(runs))
+		}
+		if runs[0].Text != "Pump " || runs[0].ID != "label" || runs[0].X != 5 || runs[0].Y != 15 {
+			t.Errorf("unexpected first run %+v", runs[0])
+		}
+		if runs[0].Transform.E != 10 || runs[0].Transform.F != 20 || runs[0].Font.Size != 12 {
+			t.Errorf("unexpected first run %+v", runs[0])
+		}
+		if runs[1].Text != "P-101" || runs[1].ID != "unit" || runs[1].Font.Weight != 700 || runs[1].X <= 5 {
+			t.Errorf("unexpected second run %+v", runs[1])
+		}
+	}
+}
+
+// encodeWOFF wraps the OpenType font in WOFF 1.0 data, compressing its tables
+func encodeWOFF(t *testing.T, font []byte) []byte {
+	be := binary.BigEndian
+	numTables := int(be.Uint16(font[4:]))
+	header := make([]byte, 44+20*numTables)
+	copy(header, "wOFF")
+	copy(header[4:], font[:4])
+	be.PutUint16(header[12:], uint16(numTables))
+	be.PutUint32(header[16:], uint32(len(font)))
+	var tables []byte
+	for i := 0; i < numTables; i++ {
+		record := font[12+16*i:]
+		offset, length := be.Uint32(record[8:]), be.Uint32(record[12:])
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		if _, err := w.Write(font[offset : offset+length]); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		table := buf.Bytes()
+		if len(table) >= int(length) {
+			table = font[offset : offset+length]
+		}
+		entry := header[44+20*i:]
+		copy(entry, record[:4])
+		be.PutUint32(entry[4:], uint32(len(header)+len(tables)))
+		be.PutUint32(entry[8:], uint32(len(table)))
+		be.PutUint32(entry[12:], length)
+		be.PutUint32(entry[16:], be.Uint32(record[4:]))
+		tables = append(tables, table...)
+		for len(tables)%4 != 0 {
+			tables = append(tables, 0)
+		}
+	}
+	return append(header, tables...)
+}
+
+func TestFontFace(t *testing.T) {
+	fonts := map[string][]byte{
+		"ttf":  gomono.TTF,
+		"woff": encodeWOFF(t, gomono.TTF),
+	}
+	for format, data := range fonts {
+		src := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 100">
+		<defs><style type="text/css"><![CDATA[
+			/* embedded font */
+			@font-face {
+				font-family: "Embedded Mono";
+				font-weight: 400;
+				src: url(missing.woff2) format("woff2"), url("data:font/` + format + `;base64,` +
+			base64.StdEncoding.EncodeToString(data) + `") format("` + format + `");
+			}
+		]]></style></defs>
+		<text x="10" y="50" font-family="'Embedded Mono', sans-serif" font-size="20">iiii</text>
+		<text x="10" y="80" font-size="20">iiii</text>
+		</svg>`
+		// without any font provider
+		s, err := Parse(strings.NewReader(src), StrictErrorMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.SvgPaths) != 2 {
+			t.Fatalf("%s: expected text drawn with the embedded font, got %d paths", format, len(s.SvgPaths))
+		}
+		// the embedded font is preferred over the provider, but not as the default font
+		s, err = Parse(strings.NewReader(src), StrictErrorMode, Fonts(testFonts(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		minX, _, maxX, _ := pathExtent(s.SvgPaths[0].Path)
+		minX2, _, maxX2, _ := pathExtent(s.SvgPaths[1].Path)
+		// glyphs of mono fonts are wide, the 'i' of a proportional font narrow
+		if w, w2 := maxX-minX, maxX2-minX2; w < 1.5*w2 {
+			t.Errorf("%s: expected the embedded monospace font, got widths %f and %f", format, w, w2)
+		}
+	}
+}
+
+func TestMalformedWOFF(t *testing.T) {
+	be := binary.BigEndian
+	for name, totalSize := range map[string]uint32{
+		"smaller than its directory": 12,
+		"too large":                  0xffffffff,
+		"smaller than its tables":    uint32(len(gomono.TTF) / 2),
+		"larger than 64 MB":          64<<20 + 1,
+	} {
+		data := encodeWOFF(t, gomono.TTF)
+		be.PutUint32(data[16:], totalSize)
+		// the data could expand to the size
+		data = append(data, make([]byte, 128<<10)...)
+		src := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 100">
+		<style>@font-face { font-family: "Broken"; src: url("data:font/woff;base64,` +
+			base64.StdEncoding.EncodeToString(data) + `") format("woff"); }</style>
+		</svg>`
+		if _, err := Parse(strings.NewReader(src), StrictErrorMode); err == nil {
+			t.Errorf("%s: expected an error for the WOFF font", name)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package svg
+
+// This file implements the pattern element, a paint server tiling its content.
+
+import (
+	"encoding/xml"
+	"math"
+	"strings"
+)
+
+// TilePattern holds a description of an SVG pattern, which
+// paints an element by repeating a tile of its content.
+type TilePattern struct {
+	ID string
+	// X, Y, W and H locate the first tile, in Units
+	X, Y, W, H   float64
+	Units        GradientUnits // patternUnits
+	ContentUnits GradientUnits // patternContentUnits
+	ViewBox      Bounds        // zero if the pattern has no viewBox
+	Matrix       Matrix2D      // patternTransform
+
+	// SvgPaths is the content of the tile. Their Transform
+	// does not include the one of the painted element.
+	SvgPaths []SvgPath
+
+	href  string
+	attrs map[string]string // own attributes, before href inheritance
+}
+
+func (*TilePattern) isPattern() {}
+
+// Tile returns the first tile, in the pattern space, and the transform of
+// the content of the pattern to the pattern space, when painting an element
+// whose bounding box, in user space, is bbox. The pattern space is the user
+// space of the element, transformed by Matrix.
+func (p *TilePattern) Tile(bbox Bounds) (tile Bounds, content Matrix2D) {
+	tile = Bounds{X: p.X, Y: p.Y, W: p.W, H: p.H}
+	if p.Units == ObjectBoundingBox {
+		tile = Bounds{X: bbox.X + p.X*bbox.W, Y: bbox.Y + p.Y*bbox.H, W: p.W * bbox.W, H: p.H * bbox.H}
+	}
+	switch {
+	case p.ViewBox.W > 0 && p.ViewBox.H > 0:
+		// the view box is centered in the tile and scaled to fit
+		s := math.Min(tile.W/p.ViewBox.W, tile.H/p.ViewBox.H)
+		content = Matrix2D{
+			A: s, D: s,
+			E: tile.X + (tile.W-s*p.ViewBox.W)/2 - s*p.ViewBox.X,
+			F: tile.Y + (tile.H-s*p.ViewBox.H)/2 - s*p.ViewBox.Y,
+		}
+	case p.ContentUnits == ObjectBoundingBox:
+		content = Matrix2D{A: bbox.W, D: bbox.H, E: tile.X, F: tile.Y}
+	default:
+		content = Identity.Translate(tile.X, tile.Y)
+	}
+	return tile, content
+}
+
+// patternAttrs are the attributes of a pattern inherited through href
+var patternAttrs = [...]string{
+	"x", "y", "width", "height", "patternUnits",
+	"patternContentUnits", "patternTransform", "viewBox",
+}
+
+func patternF(c *svgCursor, attrs []xml.Attr) error {
+	p := &TilePattern{attrs: make(map[string]string)}
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "id":
+			p.ID = attr.Value
+		case "href":
+			p.href = attr.Value
+		default:
+			for _, name := range patternAttrs {
+				if attr.Name.Local == name {
+					p.attrs[name] = attr.Value
+				}
+			}
+		}
+	}
+	if p.ID != "" {
+		c.svg.patterns[p.ID] = p
+	}
+	// the content of the pattern does not depend on the painted element,
+	// nor on the ancestors of the pattern element
+	style := &c.styleStack[len(c.styleStack)-1]
+	style.Transform = Identity
+	style.ClipPaths = nil
+	style.Masks = nil
+	c.pattern = p
+	return nil
+}
+
+// resolvePatterns applies the attributes and content inherited through
+// href, once the whole document is known.
+func (c *svgCursor) resolvePatterns() error {
+	for _, p := range c.svg.patterns {
+		// the chain of referenced patterns, without cycles
+		chain := []*TilePattern{p}
+		for q := p; strings.HasPrefix(q.href, "#"); {
+			var ok bool
+			if q, ok = c.svg.patterns[q.href[1:]]; !ok || containsPattern(chain, q) {
+				break
+			}
+			chain = append(chain, q)
+		}
+		attrs := make(map[string]string)
+		for i := len(chain) - 1; i >= 0; i-- {
+			for k, v := range chain[i].attrs {
+				attrs[k] = v
+			}
+		}
+		for _, q := range chain {
+			if len(q.SvgPaths) > 0 {
+				p.SvgPaths = q.SvgPaths
+				break
+			}
+		}
+		if err := c.compilePattern(p, attrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// breakPatternCycles removes the paint of the content of the
+// patterns painted with themselves, once paints are resolved
+func (c *svgCursor) breakPatternCycles() {
+	for _, p := range c.svg.patterns {
+		for i := range p.SvgPaths {
+			style := &p.SvgPaths[i].Style
+			if q, ok := style.FillerColor.(*TilePattern); ok && patternUses(q, p, nil) {
+				style.FillerColor = nil
+			}
+			if q, ok := style.LinerColor.(*TilePattern); ok && patternUses(q, p, nil) {
+				style.LinerColor = nil
+			}
+		}
+	}
+}
+
+// compilePattern sets the fields of the pattern from its attributes
+func (c *svgCursor) compilePattern(p *TilePattern, attrs map[string]string) error {
+	p.Units, p.ContentUnits, p.Matrix = ObjectBoundingBox, UserSpaceOnUse, Identity
+	if attrs["patternUnits"] == "userSpaceOnUse" {
+		p.Units = UserSpaceOnUse
+	}
+	if attrs["patternContentUnits"] == "objectBoundingBox" {
+		p.ContentUnits = ObjectBoundingBox
+	}
+	// percentages are fractions of the bounding box,
+	// or refer to the view box of the document
+	bbox := Bounds{W: 1, H: 1}
+	if p.Units == UserSpaceOnUse {
+		bbox = c.viewBox()
+	}
+	var err error
+	for _, v := range [...]struct {
+		name  string
+		field *float64
+		perc  percentageReference
+	}{
+		{"x", &p.X, widthPercentage},
+		{"y", &p.Y, heightPercentage},
+		{"width", &p.W, widthPercentage},
+		{"height", &p.H, heightPercentage},
+	} {
+		if s, ok := attrs[v.name]; ok {
+			if *v.field, err = bbox.resolveUnit(s, v.perc); err != nil {
+				return err
+			}
+		}
+	}
+	if s, ok := attrs["patternTransform"]; ok {
+		if p.Matrix, err = c.parseTransformFrom(Identity, s); err != nil {
+			return err
+		}
+	}
+	if s, ok := attrs["viewBox"]; ok {
+		p.ViewBox, err = c.parseViewBox(s)
+	}
+	return err
+}
+
+// patternUses reports whether the content of p is painted
+// with target, directly or not
+func patternUses(p, target *TilePattern, visited []*TilePattern) bool {
+	if p == target {
+		return true
+	}
+	if containsPattern(visited, p) {
+		return false
+	}
+	visited = append(visited, p)
+	for _, path := range p.SvgPaths {
+		for _, paint := range [2]Pattern{path.Style.FillerColor, path.Style.LinerColor} {
+			if q, ok := paint.(*TilePattern); ok && patternUses(q, target, visited) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsPattern(list []*TilePattern, p *TilePattern) bool {
+	for _, q := range list {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
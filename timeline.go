@@ -0,0 +1,665 @@
+package svg
+
+// This file implements the evaluation of the animations
+// of a document at a given time.
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/image/math/fixed"
+)
+
+// maxScheduleRounds limits the propagation of the begin and
+// end times through syncbase values, which may be cyclic
+const maxScheduleRounds = 1000
+
+// interval is an active interval of an animation
+type interval struct{ begin, end time.Duration }
+
+// activeDuration returns the duration of an interval of the animation,
+// before it is cut by its end attribute
+func (a *Animation) activeDuration() time.Duration {
+	ad := Indefinite
+	if a.RepeatCount == 0 && a.RepeatDur == 0 {
+		return a.Dur
+	}
+	if a.RepeatCount > 0 && !math.IsInf(a.RepeatCount, 1) && a.Dur != Indefinite {
+		ad = time.Duration(a.RepeatCount * float64(a.Dur))
+	}
+	if a.RepeatDur > 0 && a.RepeatDur < ad {
+		ad = a.RepeatDur
+	}
+	return ad
+}
+
+// intervals returns the active intervals of the animation, given the
+// sorted instance times of its begin and end. A new interval ends
+// the previous one.
+func (a *Animation) intervals(begins, ends []time.Duration) []interval {
+	ad := a.activeDuration()
+	out := make([]interval, 0, len(begins))
+	for k, b := range begins {
+		end := Indefinite
+		if ad != Indefinite {
+			end = b + ad
+		}
+		if i := sort.Search(len(ends), func(i int) bool { return ends[i] > b }); i < len(ends) && ends[i] < end {
+			end = ends[i]
+		}
+		if k+1 < len(begins) && begins[k+1] < end {
+			end = begins[k+1]
+		}
+		out = append(out, interval{begin: b, end: end})
+	}
+	return out
+}
+
+// schedule returns the active intervals of the animations beginning
+// until horizon. Syncbase values are resolved by propagating the
+// begin and end times of the other animations.
+func schedule(anims []*Animation, horizon time.Duration) [][]interval {
+	byID := make(map[string]int)
+	for i, a := range anims {
+		if a.ID != "" {
+			byID[a.ID] = i
+		}
+	}
+	begins := make([][]time.Duration, len(anims))
+	ends := make([][]time.Duration, len(anims))
+	insert := func(times []time.Duration, t time.Duration) ([]time.Duration, bool) {
+		i := sort.Search(len(times), func(i int) bool { return times[i] >= t })
+		if i < len(times) && times[i] == t {
+			return times, false
+		}
+		times = append(times, 0)
+		copy(times[i+1:], times[i:])
+		times[i] = t
+		return times, true
+	}
+	// resolve adds the instance times given by values, returning true
+	// if new times were added
+	resolve := func(times *[]time.Duration, values []TimingValue, intervals [][]interval) bool {
+		added := false
+		for _, tv := range values {
+			switch {
+			case tv.Unresolved:
+			case tv.Syncbase == "":
+				if tv.Offset <= horizon {
+					var ok bool
+					*times, ok = insert(*times, tv.Offset)
+					added = added || ok
+				}
+			case intervals != nil:
+				j, ok := byID[tv.Syncbase]
+				if !ok {
+					continue
+				}
+				for _, iv := range intervals[j] {
+					t := iv.begin
+					if tv.SyncEnd {
+						t = iv.end
+					}
+					if t == Indefinite || t+tv.Offset > horizon {
+						continue
+					}
+					*times, ok = insert(*times, t+tv.Offset)
+					added = added || ok
+				}
+			}
+		}
+		return added
+	}
+	for i, a := range anims {
+		resolve(&begins[i], a.Begin, nil)
+		resolve(&ends[i], a.End, nil)
+	}
+	intervals := make([][]interval, len(anims))
+	for round := 0; round < maxScheduleRounds; round++ {
+		for i, a := range anims {
+			intervals[i] = a.intervals(begins[i], ends[i])
+		}
+		added := false
+		for i, a := range anims {
+			if resolve(&begins[i], a.Begin, intervals) {
+				added = true
+			}
+			if resolve(&ends[i], a.End, intervals) {
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	return intervals
+}
+
+// state returns the iteration and the progress, in [0, 1], within
+// the simple duration of the animation at t. ok is false if the
+// animation does not apply at t.
+func (a *Animation) state(intervals []interval, t time.Duration) (iteration int, progress float64, ok bool) {
+	i := sort.Search(len(intervals), func(i int) bool { return intervals[i].begin > t }) - 1
+	if i < 0 {
+		return 0, a.directed(0, 0), a.backwards
+	}
+	iv := intervals[i]
+	elapsed := t - iv.begin
+	if t >= iv.end {
+		if !a.Freeze {
+			return 0, 0, false
+		}
+		elapsed = iv.end - iv.begin
+	}
+	if a.Dur == Indefinite {
+		return 0, a.directed(0, 0), true
+	}
+	iteration, rem := int(elapsed/a.Dur), elapsed%a.Dur
+	if t >= iv.end && rem == 0 && iteration > 0 {
+		// frozen at the end of the last iteration
+		return iteration - 1, a.directed(iteration-1, 1), true
+	}
+	return iteration, a.directed(iteration, float64(rem)/float64(a.Dur)), true
+}
+
+// directed returns the progress of the given iteration
+// in the direction of a CSS animation
+func (a *Animation) directed(iteration int, progress float64) float64 {
+	switch a.direction {
+	case "reverse":
+		return 1 - progress
+	case "alternate":
+		if iteration%2 == 1 {
+			return 1 - progress
+		}
+	case "alternate-reverse":
+		if iteration%2 == 0 {
+			return 1 - progress
+		}
+	}
+	return progress
+}
+
+// segment returns the index of the interval of values, and the progress
+// within it, at the given progress of the simple duration
+func (a *Animation) segment(progress float64, distances []float64) (int, float64) {
+	n := len(a.Values)
+	if a.Element == "animateMotion" && len(a.KeyPoints) > 0 {
+		n = len(a.KeyPoints)
+	}
+	if a.CalcMode == CalcDiscrete {
+		keyTimes := a.KeyTimes
+		if len(keyTimes) != n {
+			keyTimes = make([]float64, n)
+			for i := range keyTimes {
+				keyTimes[i] = float64(i) / float64(n)
+			}
+		}
+		i := sort.Search(n, func(i int) bool { return keyTimes[i] > progress }) - 1
+		if progress >= 1 {
+			i = n - 1
+		}
+		return clampIndex(i, n-1), 0
+	}
+	if n < 2 {
+		return 0, 0
+	}
+	keyTimes := a.KeyTimes
+	if a.CalcMode == CalcPaced && len(distances) == n-1 {
+		// key times proportional to the distances between the values
+		var total float64
+		for _, d := range distances {
+			total += d
+		}
+		if total > 0 {
+			keyTimes = make([]float64, n)
+			for i, d := range distances {
+				keyTimes[i+1] = keyTimes[i] + d/total
+			}
+		}
+	}
+	if len(keyTimes) != n {
+		keyTimes = make([]float64, n)
+		for i := range keyTimes {
+			keyTimes[i] = float64(i) / float64(n-1)
+		}
+	}
+	i := sort.Search(n, func(i int) bool { return keyTimes[i] > progress }) - 1
+	i = clampIndex(i, n-2)
+	local := 0.
+	if span := keyTimes[i+1] - keyTimes[i]; span > 0 {
+		local = math.Max(0, math.Min(1, (progress-keyTimes[i])/span))
+	}
+	if a.CalcMode == CalcSpline && i < len(a.KeySplines) {
+		local = splineEasing(a.KeySplines[i], local)
+	}
+	if i < len(a.easings) && a.easings[i] != nil {
+		local = a.easings[i](local)
+	}
+	return i, local
+}
+
+// splineEasing returns the value of the cubic Bézier easing function
+// with the control points (x1, y1) and (x2, y2) of spline at x
+func splineEasing(spline [4]float64, x float64) float64 {
+	bezier := func(p1, p2, t float64) float64 {
+		s := 1 - t
+		return 3*s*s*t*p1 + 3*s*t*t*p2 + t*t*t
+	}
+	lo, hi := 0., 1.
+	for i := 0; i < 32; i++ {
+		mid := (lo + hi) / 2
+		if bezier(spline[0], spline[2], mid) < x {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return bezier(spline[1], spline[3], (lo+hi)/2)
+}
+
+// value returns the value of the animation at the given iteration and
+// progress, for the given base value of the attribute
+func (a *Animation) value(iteration int, progress float64, base string) string {
+	values := make([]string, len(a.Values))
+	for i, v := range a.Values {
+		if v == "" {
+			v = base
+		}
+		values[i] = v
+	}
+	if len(values) == 0 {
+		return base
+	}
+	var distances []float64
+	if a.CalcMode == CalcPaced {
+		for i := 1; i < len(values); i++ {
+			distances = append(distances, valueDistance(values[i-1], values[i]))
+		}
+	}
+	i, local := a.segment(progress, distances)
+	v := values[i]
+	if a.CalcMode != CalcDiscrete && i+1 < len(values) {
+		v = interpolateValues(values[i], values[i+1], local)
+	}
+	if a.Accumulate && iteration > 0 {
+		v = addValues(v, values[len(values)-1], float64(iteration))
+	}
+	if a.Element == "animateTransform" {
+		v = a.Type + "(" + v + ")"
+		if a.Additive {
+			return strings.TrimSpace(base + " " + v)
+		}
+		return v
+	}
+	if a.Additive {
+		return addValues(base, v, 1)
+	}
+	return v
+}
+
+// motion returns the supplemental transform of an animateMotion
+// element at the given iteration and progress
+func (a *Animation) motion(iteration int, progress float64) string {
+	path := a.Path
+	var vertices []float64 // distances of the values along the path
+	if len(path) == 0 {
+		// the path goes through the values
+		var pc pathCursor
+		for i, v := range a.Values {
+			if err := pc.getPoints(v); err != nil || len(pc.points) != 2 {
+				return ""
+			}
+			pt := fixed.Point26_6{X: fToFixed(pc.points[0]), Y: fToFixed(pc.points[1])}
+			if i == 0 {
+				path.Start(pt)
+			} else {
+				path.Line(pt)
+			}
+		}
+	}
+	pl := flattenPath(path, Identity)
+	if len(pl) < 2 {
+		return ""
+	}
+	if len(a.Path) == 0 {
+		for _, pt := range pl {
+			vertices = append(vertices, pt.dist)
+		}
+	}
+	var fraction float64
+	switch {
+	case len(a.KeyPoints) > 0:
+		i, local := a.segment(progress, nil)
+		fraction = a.KeyPoints[i]
+		if a.CalcMode != CalcDiscrete && i+1 < len(a.KeyPoints) {
+			fraction += local * (a.KeyPoints[i+1] - a.KeyPoints[i])
+		}
+	case a.CalcMode != CalcPaced && len(vertices) == len(a.Values) && len(vertices) > 1:
+		i, local := a.segment(progress, nil)
+		d := vertices[i]
+		if a.CalcMode != CalcDiscrete && i+1 < len(vertices) {
+			d += local * (vertices[i+1] - vertices[i])
+		}
+		fraction = d / pl.length()
+	default:
+		fraction = progress
+	}
+	x, y, angle := pl.atExtended(fraction * pl.length())
+	if a.Accumulate && iteration > 0 {
+		endX, endY, _ := pl.atExtended(pl.length())
+		x, y = x+float64(iteration)*endX, y+float64(iteration)*endY
+	}
+	out := "translate(" + formatNumber(x) + "," + formatNumber(y) + ")"
+	switch a.Rotate {
+	case "", "0":
+	case "auto":
+		out += " rotate(" + formatNumber(angle*180/math.Pi) + ")"
+	case "auto-reverse":
+		out += " rotate(" + formatNumber(angle*180/math.Pi+180) + ")"
+	default:
+		out += " rotate(" + a.Rotate + ")"
+	}
+	return out
+}
+
+var numberRe = regexp.MustCompile(`[-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?`)
+
+// splitNumbers splits s into its numbers and the
+// text around them, which has one more item
+func splitNumbers(s string) (text []string, numbers []float64) {
+	last := 0
+	for _, loc := range numberRe.FindAllStringIndex(s, -1) {
+		f, err := strconv.ParseFloat(s[loc[0]:loc[1]], 64)
+		if err != nil {
+			continue
+		}
+		text = append(text, s[last:loc[0]])
+		numbers = append(numbers, f)
+		last = loc[1]
+	}
+	return append(text, s[last:]), numbers
+}
+
+// joinNumbers is the inverse of splitNumbers
+func joinNumbers(text []string, numbers []float64) string {
+	var sb strings.Builder
+	for i, f := range numbers {
+		sb.WriteString(text[i])
+		sb.WriteString(formatNumber(f))
+	}
+	sb.WriteString(text[len(text)-1])
+	return sb.String()
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(math.Round(f*1e6)/1e6, 'f', -1, 64)
+}
+
+// sameTemplate returns true if the numbers of two values,
+// split by splitNumbers, may be combined
+func sameTemplate(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if strings.Trim(a[i], " ,\t\n") != strings.Trim(b[i], " ,\t\n") {
+			return false
+		}
+	}
+	return true
+}
+
+// animationColor returns the color of an animated value, if it is one
+func animationColor(v string) (PlainColor, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" || strings.HasPrefix(v, "url") {
+		return PlainColor{}, false
+	}
+	if v[0] != '#' && !strings.HasPrefix(v, "rgb") && numberRe.MatchString(v) {
+		return PlainColor{}, false // numbers and lengths
+	}
+	c, err := parseSVGColor(v)
+	if err != nil || !c.valid {
+		return PlainColor{}, false
+	}
+	return c.color, true
+}
+
+func formatColor(r, g, b float64) string {
+	clamp := func(f float64) uint8 { return uint8(math.Round(math.Max(0, math.Min(255, f)))) }
+	return fmt.Sprintf("#%02x%02x%02x", clamp(r), clamp(g), clamp(b))
+}
+
+// interpolateValues returns the value at t between a and b. Values
+// which can not be interpolated switch from a to b half way.
+func interpolateValues(a, b string, t float64) string {
+	if ca, ok := animationColor(a); ok {
+		if cb, ok := animationColor(b); ok {
+			lerp := func(x, y uint8) float64 { return float64(x) + t*(float64(y)-float64(x)) }
+			return formatColor(lerp(ca.R, cb.R), lerp(ca.G, cb.G), lerp(ca.B, cb.B))
+		}
+	}
+	ta, na := splitNumbers(a)
+	tb, nb := splitNumbers(b)
+	if len(na) == 0 || !sameTemplate(ta, tb) {
+		if t < 0.5 {
+			return a
+		}
+		return b
+	}
+	out := make([]float64, len(na))
+	for i := range na {
+		out[i] = na[i] + t*(nb[i]-na[i])
+	}
+	return joinNumbers(tb, out)
+}
+
+// addValues returns a + k*b, or b if they can not be added
+func addValues(a, b string, k float64) string {
+	if ca, ok := animationColor(a); ok {
+		if cb, ok := animationColor(b); ok {
+			return formatColor(float64(ca.R)+k*float64(cb.R), float64(ca.G)+k*float64(cb.G), float64(ca.B)+k*float64(cb.B))
+		}
+	}
+	ta, na := splitNumbers(a)
+	tb, nb := splitNumbers(b)
+	if strings.TrimSpace(a) == "" {
+		na, ta = make([]float64, len(nb)), tb
+	}
+	if !sameTemplate(ta, tb) {
+		return b
+	}
+	out := make([]float64, len(nb))
+	for i := range nb {
+		out[i] = na[i] + k*nb[i]
+	}
+	return joinNumbers(tb, out)
+}
+
+// zeroValue returns v with its numbers set to zero
+func zeroValue(v string) string {
+	if _, ok := animationColor(v); ok {
+		return "#000000"
+	}
+	text, numbers := splitNumbers(v)
+	return joinNumbers(text, make([]float64, len(numbers)))
+}
+
+// valueDistance returns the distance between two values,
+// used by the paced interpolation
+func valueDistance(a, b string) float64 {
+	if ca, ok := animationColor(a); ok {
+		if cb, ok := animationColor(b); ok {
+			return math.Sqrt(sq(float64(ca.R)-float64(cb.R)) + sq(float64(ca.G)-float64(cb.G)) + sq(float64(ca.B)-float64(cb.B)))
+		}
+	}
+	ta, na := splitNumbers(a)
+	tb, nb := splitNumbers(b)
+	if !sameTemplate(ta, tb) {
+		return 1
+	}
+	var d float64
+	for i := range na {
+		d += sq(na[i] - nb[i])
+	}
+	return math.Sqrt(d)
+}
+
+func sq(f float64) float64 { return f * f }
+
+// attrValue returns the value of the attribute or property name
+// of an element, which may be given in its style attribute
+func attrValue(attrs []xml.Attr, name string) string {
+	value := ""
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case name:
+			value = attr.Value
+		case "style":
+			for _, decl := range strings.Split(attr.Value, ";") {
+				if k, v, ok := strings.Cut(decl, ":"); ok && strings.TrimSpace(k) == name {
+					value = strings.TrimSpace(v)
+				}
+			}
+		}
+	}
+	return value
+}
+
+// animate returns the tokens of the document with the
+// animated attributes set to their values at t
+func animate(doc *tokenized, anims []*Animation, t time.Duration) []xml.Token {
+	intervals := schedule(anims, t)
+	type animated struct {
+		names  []string // in the order they are animated
+		values map[string]string
+		motion string
+	}
+	targets := make(map[int]*animated)
+	for i, a := range anims {
+		iteration, progress, ok := a.state(intervals[i], t)
+		if !ok {
+			continue
+		}
+		se := doc.tokens[a.target].(xml.StartElement)
+		target := targets[a.target]
+		if target == nil {
+			target = &animated{values: make(map[string]string)}
+			targets[a.target] = target
+		}
+		if a.Element == "animateMotion" {
+			target.motion = strings.TrimSpace(target.motion + " " + a.motion(iteration, progress))
+			continue
+		}
+		base, ok := target.values[a.Attribute]
+		if !ok {
+			base = attrValue(se.Attr, a.Attribute)
+			target.names = append(target.names, a.Attribute)
+		}
+		target.values[a.Attribute] = a.value(iteration, progress, base)
+	}
+	tokens := make([]xml.Token, len(doc.tokens))
+	copy(tokens, doc.tokens)
+	for i, target := range targets {
+		se := tokens[i].(xml.StartElement)
+		if target.motion != "" {
+			// the motion is applied after the transform of the element
+			transform, ok := target.values["transform"]
+			if !ok {
+				transform = attrValue(se.Attr, "transform")
+				target.names = append(target.names, "transform")
+			}
+			target.values["transform"] = strings.TrimSpace(transform + " " + target.motion)
+		}
+		// animated values replace the attributes and the declarations of
+		// the style attribute
+		attrs := make([]xml.Attr, 0, len(se.Attr)+len(target.names))
+		for _, attr := range se.Attr {
+			if _, ok := target.values[attr.Name.Local]; ok {
+				continue
+			}
+			if attr.Name.Local == "style" {
+				var decls []string
+				for _, decl := range strings.Split(attr.Value, ";") {
+					k, _, _ := strings.Cut(decl, ":")
+					if _, ok := target.values[strings.TrimSpace(k)]; !ok {
+						decls = append(decls, decl)
+					}
+				}
+				attr.Value = strings.Join(decls, ";")
+			}
+			attrs = append(attrs, attr)
+		}
+		for _, name := range target.names {
+			attrs = append(attrs, xml.Attr{Name: xml.Name{Local: name}, Value: target.values[name]})
+		}
+		se.Attr = attrs
+		tokens[i] = se
+	}
+	return tokens
+}
+
+// At returns a snapshot of the image at the time t of its timeline, with
+// the animated attributes set to their values. The snapshot is parsed
+// with the error mode and the options of the image: if an animated value
+// is invalid, it is returned as far as it could be read, with the error.
+func (s *Svg) At(t time.Duration) (*Svg, error) {
+	static := s.static
+	if static == nil {
+		static = s.doc
+	}
+	doc := &tokenized{tokens: animate(static, s.Animations, t), ids: static.ids}
+	snapshot, err := parseTokens(doc, s.errorMode, s.options)
+	snapshot.Animations, snapshot.static = s.Animations, static
+	return snapshot, err
+}
+
+// Duration returns the time at which the last animation of the image
+// ends. The animations repeating indefinitely count for the first
+// iteration. It is 0 if the image has no animation.
+func (s *Svg) Duration() time.Duration {
+	// the first intervals begin before the sum of all the durations
+	var horizon time.Duration
+	for _, a := range s.Animations {
+		for _, tv := range a.Begin {
+			if tv.Offset > 0 {
+				horizon += tv.Offset
+			}
+		}
+		if ad := a.activeDuration(); ad != Indefinite {
+			horizon += ad
+		} else if a.Dur != Indefinite {
+			horizon += a.Dur
+		}
+	}
+	var end time.Duration
+	for i, intervals := range schedule(s.Animations, horizon) {
+		if len(intervals) == 0 {
+			continue
+		}
+		a, first := s.Animations[i], intervals[0]
+		switch {
+		case first.end != Indefinite:
+			end = maxDuration(end, first.end)
+		case a.Dur != Indefinite:
+			end = maxDuration(end, first.begin+a.Dur)
+		default:
+			end = maxDuration(end, first.begin)
+		}
+	}
+	return end
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
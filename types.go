@@ -1,6 +1,8 @@
 package svg
 
 import (
+	"strings"
+
 	"golang.org/x/image/math/fixed"
 )
 
@@ -112,6 +114,23 @@ type JoinOptions struct {
 	LineGap     GapMode // not part of the standard specification. determines how a gap on the convex side of two lines joining is filled
 }
 
+// FontOptions holds the font properties used to lay out text.
+type FontOptions struct {
+	Family string    // font-family, as a comma separated list of family names
+	Size   float64   // font-size in user units
+	Weight int       // font-weight, from 100 to 900
+	Style  FontStyle // font-style
+}
+
+// TextOptions holds the properties used to lay out text, besides the font.
+type TextOptions struct {
+	Anchor            TextAnchor
+	DominantBaseline  Baseline
+	AlignmentBaseline Baseline // not inherited
+	LetterSpacing     float64
+	WordSpacing       float64
+}
+
 type StrokeOptions struct {
 	LineWidth fixed.Int26_6 // width of the line
 	Join      JoinOptions
@@ -121,16 +140,138 @@ type StrokeOptions struct {
 // DefaultStyle sets the default PathStyle to fill black, winding rule,
 // full opacity, no stroke, ButtCap line end and Bevel line connect.
 var DefaultStyle = PathStyle{
-	FillOpacity:       1.0,
-	LineOpacity:       1.0,
-	LineWidth:         2.0,
-	UseNonZeroWinding: true,
+	Opacity:            1.0,
+	FillOpacity:        1.0,
+	LineOpacity:        1.0,
+	LineWidth:          2.0,
+	UseNonZeroWinding:  true,
+	ClipNonZeroWinding: true,
 	Join: JoinOptions{
 		MiterLimit:   fToFixed(4.),
 		LineJoin:     Bevel,
 		TrailLineCap: ButtCap,
 	},
+	Font: FontOptions{
+		Size:   16,
+		Weight: 400,
+	},
 	FillerColor: NewPlainColor(0x00, 0x00, 0x00, 0xff),
 	Transform:   Identity,
 	Masks:       make([]string, 0),
 }
+
+// PaintLayer is one of the layers painted for a shape.
+type PaintLayer uint8
+
+const (
+	PaintFill    PaintLayer = iota // the fill of the shape
+	PaintStroke                    // the stroke of the shape
+	PaintMarkers                   // the markers placed on the shape
+)
+
+func (l PaintLayer) String() string {
+	switch l {
+	case PaintFill:
+		return "fill"
+	case PaintStroke:
+		return "stroke"
+	case PaintMarkers:
+		return "markers"
+	default:
+		return "<unknown PaintLayer>"
+	}
+}
+
+// PaintOrder defines the order in which the fill, the stroke and the
+// markers of a shape are painted, as given by the paint-order property.
+type PaintOrder uint8
+
+const (
+	PaintNormal            PaintOrder = iota // fill, stroke then markers
+	PaintFillMarkersStroke                   // fill, markers then stroke
+	PaintStrokeFillMarkers                   // stroke, fill then markers
+	PaintStrokeMarkersFill                   // stroke, markers then fill
+	PaintMarkersFillStroke                   // markers, fill then stroke
+	PaintMarkersStrokeFill                   // markers, stroke then fill
+)
+
+// paintOrders holds the layers of each PaintOrder, from bottom to top
+var paintOrders = [...][3]PaintLayer{
+	PaintNormal:            {PaintFill, PaintStroke, PaintMarkers},
+	PaintFillMarkersStroke: {PaintFill, PaintMarkers, PaintStroke},
+	PaintStrokeFillMarkers: {PaintStroke, PaintFill, PaintMarkers},
+	PaintStrokeMarkersFill: {PaintStroke, PaintMarkers, PaintFill},
+	PaintMarkersFillStroke: {PaintMarkers, PaintFill, PaintStroke},
+	PaintMarkersStrokeFill: {PaintMarkers, PaintStroke, PaintFill},
+}
+
+// Layers returns the layers in painting order.
+func (o PaintOrder) Layers() [3]PaintLayer {
+	if int(o) >= len(paintOrders) {
+		return paintOrders[PaintNormal]
+	}
+	return paintOrders[o]
+}
+
+// StrokeFirst returns true if the stroke is painted below the fill.
+func (o PaintOrder) StrokeFirst() bool {
+	for _, l := range o.Layers() {
+		if l != PaintMarkers {
+			return l == PaintStroke
+		}
+	}
+	return false
+}
+
+func (o PaintOrder) String() string {
+	if o == PaintNormal {
+		return "normal"
+	}
+	l := o.Layers()
+	return l[0].String() + " " + l[1].String() + " " + l[2].String()
+}
+
+// parsePaintOrder parses the value of the paint-order property, where
+// omitted layers are painted last, in their normal order.
+func parsePaintOrder(v string) (PaintOrder, bool) {
+	fields := strings.Fields(v)
+	if len(fields) == 1 && fields[0] == "normal" {
+		return PaintNormal, true
+	}
+	if len(fields) == 0 || len(fields) > 3 {
+		return PaintNormal, false
+	}
+	var (
+		layers []PaintLayer
+		seen   [3]bool
+	)
+	for _, f := range fields {
+		var l PaintLayer
+		switch f {
+		case "fill":
+			l = PaintFill
+		case "stroke":
+			l = PaintStroke
+		case "markers":
+			l = PaintMarkers
+		default:
+			return PaintNormal, false
+		}
+		if seen[l] {
+			return PaintNormal, false
+		}
+		seen[l] = true
+		layers = append(layers, l)
+	}
+	for l, ok := range seen {
+		if !ok {
+			layers = append(layers, PaintLayer(l))
+		}
+	}
+	for o, order := range paintOrders {
+		if order == [3]PaintLayer{layers[0], layers[1], layers[2]} {
+			return PaintOrder(o), true
+		}
+	}
+	return PaintNormal, false
+}
@@ -78,9 +78,9 @@ func (viewBox Bounds) resolveUnit(s string, asPerc percentageReference) (float64
 }
 
 // parseUnit converts a length with a unit into its value in 'px'
-// percentage are supported, and refer to the current ViewBox
+// percentage are supported, and refer to the view box of the nearest svg element
 func (c *svgCursor) parseUnit(s string, asPerc percentageReference) (float64, error) {
-	return c.svg.ViewBox.resolveUnit(s, asPerc)
+	return c.viewBox().resolveUnit(s, asPerc)
 }
 
 func parseBasicFloat(s string) (float64, error) {
@@ -105,3 +105,14 @@ func readFraction(v string) (f float64, err error) {
 	// }
 	return
 }
+
+// parseViewBox parses the value of a viewBox attribute
+func (c *svgCursor) parseViewBox(v string) (Bounds, error) {
+	if err := c.getPoints(v); err != nil {
+		return Bounds{}, err
+	}
+	if len(c.points) != 4 {
+		return Bounds{}, errParamMismatch
+	}
+	return Bounds{X: c.points[0], Y: c.points[1], W: c.points[2], H: c.points[3]}, nil
+}
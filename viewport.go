@@ -0,0 +1,89 @@
+package svg
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// viewportClipPrefix starts the ids of the clip paths of nested svg
+// elements and markers, which cannot collide with the ids of the document
+const viewportClipPrefix = "viewport "
+
+// viewBox returns the view box of the nearest svg element,
+// which percentages are relative to
+func (c *svgCursor) viewBox() Bounds {
+	if n := len(c.viewports); n > 0 {
+		return c.viewports[n-1]
+	}
+	return c.svg.ViewBox
+}
+
+// nestedSvgF starts an svg element inside the root one: its content is
+// drawn in the viewport given by its position and size, clipped to it
+// unless its overflow is visible.
+func nestedSvgF(c *svgCursor, attrs []xml.Attr) error {
+	var (
+		viewport      Bounds
+		box           Bounds
+		aspectRatio   AspectRatio
+		width, height = "100%", "100%"
+		clip          = true
+		err           error
+	)
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "x":
+			viewport.X, err = c.parseUnit(attr.Value, widthPercentage)
+		case "y":
+			viewport.Y, err = c.parseUnit(attr.Value, heightPercentage)
+		case "width":
+			width = attr.Value
+		case "height":
+			height = attr.Value
+		case "viewBox":
+			box, err = c.parseViewBox(attr.Value)
+		case "preserveAspectRatio":
+			aspectRatio, err = parseAspectRatio(attr.Value)
+		case "overflow":
+			clip = attr.Value != "visible" && attr.Value != "auto"
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if viewport.W, err = c.parseUnit(width, widthPercentage); err != nil {
+		return err
+	}
+	if viewport.H, err = c.parseUnit(height, heightPercentage); err != nil {
+		return err
+	}
+
+	style := &c.styleStack[len(c.styleStack)-1]
+	if clip {
+		c.clipViewport(style, viewport)
+	}
+	if box.W > 0 && box.H > 0 {
+		style.Transform = style.Transform.Mult(aspectRatio.Transform(box, viewport))
+	} else {
+		box = Bounds{W: viewport.W, H: viewport.H}
+		style.Transform = style.Transform.Mult(Identity.Translate(viewport.X, viewport.Y))
+	}
+	c.viewports = append(c.viewports, box)
+	return nil
+}
+
+// clipViewport restricts the drawing of the elements using
+// the style to the viewport, given in its user space
+func (c *svgCursor) clipViewport(style *PathStyle, viewport Bounds) {
+	cp := &SvgClipPath{
+		ID:    fmt.Sprintf("%s%d", viewportClipPrefix, len(c.svg.ClipPaths)),
+		Units: UserSpaceOnUse,
+	}
+	var p Path
+	p.addRect(viewport.X, viewport.Y, viewport.X+viewport.W, viewport.Y+viewport.H, 0)
+	cp.SvgPaths = []SvgPath{{Path: p, Style: DefaultStyle}}
+	c.svg.ClipPaths[cp.ID] = cp
+	// the slice is copied, as it is shared with the parent style
+	n := len(style.ClipPaths)
+	style.ClipPaths = append(style.ClipPaths[:n:n], &ClipRef{ID: cp.ID, Transform: style.Transform})
+}